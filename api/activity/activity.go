@@ -52,7 +52,7 @@ func AddActivity(c *fiber.Ctx) error {
 			return
 		}
 		for _, member := range members {
-			err := ws.WriteToUser(member.ID, &struct {
+			err := ws.WriteToUser(member.FriendID, &struct {
 				Type     int64 `json:"type"`
 				Activity struct {
 					ActivityID int64 `json:"activity_id"`
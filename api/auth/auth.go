@@ -3,12 +3,14 @@ package auth
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/api/mobile"
 	"github.com/thss-cercis/cercis-server/db"
 	userDB "github.com/thss-cercis/cercis-server/db/user"
 	"github.com/thss-cercis/cercis-server/middleware"
 	"github.com/thss-cercis/cercis-server/redis"
 	"github.com/thss-cercis/cercis-server/util"
 	"github.com/thss-cercis/cercis-server/util/security"
+	"strconv"
 )
 
 // Login 用户登录
@@ -28,45 +30,108 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	// 验证密码
-	var u *userDB.User
-	var err error
-	if req.ID != 0 {
-		// 使用 id
-		u, err = userDB.GetUserByID(db.GetDB(), req.ID)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserIDNotFound, Msg: util.MsgWithError(api.MsgUserNotFound, err)})
-		}
-	} else {
-		// 使用 mobile
-		u, err = userDB.GetUserByMobile(db.GetDB(), req.Mobile)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserIDNotFound, Msg: util.MsgWithError(api.MsgUserNotFound, err)})
-		}
+	u, ok, err := verifyPassword(c, req.ID, req.Mobile, req.Password)
+	if !ok {
+		return err
 	}
-	if !security.CheckPasswordHash(req.Password, u.Password) {
-		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserBadPassword, Msg: "密码错误"})
+
+	return createSession(c, u.ID)
+}
+
+// LoginBySMS 使用手机号与短信验证码登录，无需密码. 登录成功后解除账户的登录锁定.
+func LoginBySMS(c *fiber.Ctx) error {
+	req := new(struct {
+		Mobile string `json:"mobile" validate:"required,phone_number"`
+		Code   string `json:"code" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
 	}
 
-	// 创建 session
+	u, err := userDB.GetUserByMobile(db.GetDB(), req.Mobile)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserIDNotFound, Msg: util.MsgWithError(api.MsgUserNotFound, err)})
+	}
+
+	// 检验 code
+	if err := mobile.VerifySMSCode(redis.TagSMSLogin, req.Mobile, req.Code); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSWrong, Msg: util.MsgWithError(api.MsgSMSWrong, err)})
+	}
+	_ = redis.DelKV(redis.TagLoginLock, strconv.FormatInt(u.ID, 10))
+	_ = redis.DelKV(redis.TagLoginFailAccount, strconv.FormatInt(u.ID, 10))
+
+	return createSession(c, u.ID)
+}
+
+// createSession 为通过验证的用户创建 cookie session 并登记设备，写入登录成功的响应
+func createSession(c *fiber.Ctx, userID int64) error {
 	sess, err := middleware.GetStore().Get(c)
 	if err != nil {
 		panic(err)
 	}
 	// 设置新 user_id
-	sess.Set("user_id", u.ID)
+	sess.Set("user_id", userID)
 	if err = sess.Save(); err != nil {
 		panic(err)
 	}
+	// 登记设备
+	if err = middleware.RegisterDevice(c, userID, sess.ID(), middleware.AuthSchemeCookie); err != nil {
+		panic(err)
+	}
 
 	return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
 		ID int64 `json:"id"`
 	}{
-		ID: u.ID,
+		ID: userID,
 	}})
 }
 
-// Logout 用户登出，销毁当前 session
+// verifyPassword 使用 id 或手机号找到用户并校验密码，ok 为 false 时已经写入了错误响应.
+// 同一 ip 或同一账户的失败次数过多时，会拒绝继续校验密码.
+func verifyPassword(c *fiber.Ctx, id int64, mobile string, password string) (u *userDB.User, ok bool, err error) {
+	if ok, err := checkIPLimit(c); !ok {
+		return nil, false, err
+	}
+	if id != 0 {
+		// 使用 id
+		u, err = userDB.GetUserByID(db.GetDB(), id)
+	} else {
+		// 使用 mobile
+		u, err = userDB.GetUserByMobile(db.GetDB(), mobile)
+	}
+	if err != nil {
+		recordIPFailure(c, 0)
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserIDNotFound, Msg: util.MsgWithError(api.MsgUserNotFound, err)})
+	}
+	if ok, err := checkAccountLock(c, u.ID); !ok {
+		return nil, false, err
+	}
+	if !security.CheckPasswordHash(password, u.Password) {
+		if recordLoginFailure(c, u.ID) {
+			return nil, false, retryRes(c, api.CodeUserLocked, api.MsgUserLocked, redis.ExpLoginLock)
+		}
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserBadPassword, Msg: "密码错误"})
+	}
+	recordLoginSuccess(c, u.ID)
+	return u, true, nil
+}
+
+// Logout 用户登出，销毁当前 session，使用 Bearer token 时吊销当前的 token 会话
 func Logout(c *fiber.Ctx) error {
+	userID, _ := middleware.GetUserIDFromSession(c)
+	sessionID, _ := middleware.GetSessionIDFromSession(c)
+	if err := middleware.RevokeSession(userID, sessionID); err != nil {
+		panic(err)
+	}
+	if middleware.IsBearerAuth(c) {
+		return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+	}
+
 	sess, err := middleware.GetSession(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
@@ -103,11 +168,8 @@ func Signup(c *fiber.Ctx) error {
 	}
 
 	// 检验 code
-	code, err := redis.GetKV(redis.TagSMSSignUp, req.Mobile)
-	if req.Code != "114514" {
-		if err != nil || code != req.Code {
-			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSWrong, Msg: util.MsgWithError(api.MsgSMSWrong, err)})
-		}
+	if err := mobile.VerifySMSCode(redis.TagSMSSignUp, req.Mobile, req.Code); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSWrong, Msg: util.MsgWithError(api.MsgSMSWrong, err)})
 	}
 
 	newPwd, err := security.HashPassword(req.Password)
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// GetDevices 获得当前用户全部登录设备的 api
+func GetDevices(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+	sessionID, _ := middleware.GetSessionIDFromSession(c)
+
+	devices, err := middleware.GetDevices(userID, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Devices []*middleware.Device `json:"devices"`
+	}{
+		Devices: devices,
+	}})
+}
+
+// RenameDevice 为登录设备设置名称的 api
+func RenameDevice(c *fiber.Ctx) error {
+	req := new(struct {
+		DeviceID string `json:"device_id" validate:"required"`
+		Name     string `json:"name" validate:"max=64"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := middleware.RenameDevice(userID, req.DeviceID, req.Name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// RevokeDevice 吊销某个登录设备的 api，其 websocket 连接会被关闭
+func RevokeDevice(c *fiber.Ctx) error {
+	req := new(struct {
+		DeviceID string `json:"device_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := middleware.RevokeDevice(userID, req.DeviceID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// RevokeOtherDevices 吊销除当前设备以外全部登录设备的 api
+func RevokeOtherDevices(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+	sessionID, _ := middleware.GetSessionIDFromSession(c)
+
+	if err := middleware.RevokeOtherDevices(userID, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
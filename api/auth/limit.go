@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	userDB "github.com/thss-cercis/cercis-server/db/user"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/redis"
+	"strconv"
+	"time"
+)
+
+var logAuthFields = logrus.Fields{
+	"module": "auth",
+	"api":    true,
+}
+
+const (
+	// maxAccountFailures 滑动窗口内同一账户允许的登录失败次数，达到后临时锁定账户
+	maxAccountFailures = 5
+	// maxIPFailures 滑动窗口内同一 ip 允许的登录失败次数，达到后拒绝该 ip 的密码登录
+	maxIPFailures = 20
+	// suspiciousFailures 登录成功前窗口内的失败次数达到此值时，记录为可疑登录
+	suspiciousFailures = 3
+)
+
+// retryRes 需要稍后重试时的响应
+func retryRes(c *fiber.Ctx, code int64, msg string, retryAfter time.Duration) error {
+	minutes := int64((retryAfter + time.Minute - 1) / time.Minute)
+	return c.Status(fiber.StatusTooManyRequests).JSON(api.BaseRes{Code: code, Msg: fmt.Sprintf("%v，请 %v 分钟后重试", msg, minutes), Payload: struct {
+		// RetryAfter 可以重试前的秒数
+		RetryAfter int64 `json:"retry_after"`
+	}{
+		RetryAfter: int64((retryAfter + time.Second - 1) / time.Second),
+	}})
+}
+
+// addAuditEvent 记录一条审计事件，失败时只打印日志
+func addAuditEvent(c *fiber.Ctx, userID int64, typ userDB.AuditEventType, detail string) {
+	err := userDB.AddAuditEvent(db.GetDB(), &userDB.AuditEvent{
+		UserID:    userID,
+		Type:      typ,
+		IP:        middleware.ClientIP(c),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Detail:    detail,
+	})
+	if err != nil {
+		logger2.GetLogger().WithFields(logAuthFields).Errorf("Add audit event for user %v fail: %v", userID, err)
+	}
+}
+
+// checkIPLimit 检查当前 ip 是否因登录失败过多被限流，ok 为 false 时已经写入了错误响应
+func checkIPLimit(c *fiber.Ctx) (ok bool, err error) {
+	count, retryAfter, err := redis.GetWindow(redis.TagLoginFailIP, middleware.ClientIP(c), redis.ExpLoginFailWindow)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: api.MsgUnknown})
+	}
+	if count >= maxIPFailures {
+		return false, retryRes(c, api.CodeLoginTooOften, api.MsgLoginTooOften, retryAfter)
+	}
+	return true, nil
+}
+
+// checkAccountLock 检查账户是否被临时锁定，ok 为 false 时已经写入了错误响应
+func checkAccountLock(c *fiber.Ctx, userID int64) (ok bool, err error) {
+	exp, err := redis.GetKVExp(redis.TagLoginLock, strconv.FormatInt(userID, 10))
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: api.MsgUnknown})
+	}
+	// 键不存在时 TTL 为负数
+	if exp > 0 {
+		return false, retryRes(c, api.CodeUserLocked, api.MsgUserLocked, exp)
+	}
+	return true, nil
+}
+
+// recordIPFailure 记录当前 ip 的一次登录失败，达到上限时记录审计事件
+func recordIPFailure(c *fiber.Ctx, userID int64) {
+	count, err := redis.PushWindow(redis.TagLoginFailIP, middleware.ClientIP(c), redis.ExpLoginFailWindow)
+	if err != nil {
+		logger2.GetLogger().WithFields(logAuthFields).Errorf("Record login failure of ip %v fail: %v", middleware.ClientIP(c), err)
+		return
+	}
+	if count == maxIPFailures {
+		addAuditEvent(c, userID, userDB.AuditLoginRateLimited, fmt.Sprintf("%v failed logins from this ip", count))
+	}
+}
+
+// recordLoginFailure 记录账户与 ip 的一次登录失败，账户失败次数达到上限时锁定账户. locked 表示账户因此被锁定.
+func recordLoginFailure(c *fiber.Ctx, userID int64) (locked bool) {
+	logger := logger2.GetLogger()
+	recordIPFailure(c, userID)
+
+	key := strconv.FormatInt(userID, 10)
+	count, err := redis.PushWindow(redis.TagLoginFailAccount, key, redis.ExpLoginFailWindow)
+	if err != nil {
+		logger.WithFields(logAuthFields).Errorf("Record login failure of user %v fail: %v", userID, err)
+		return false
+	}
+	if count < maxAccountFailures {
+		return false
+	}
+	if err := redis.PutKV(redis.TagLoginLock, key, middleware.ClientIP(c), redis.ExpLoginLock); err != nil {
+		logger.WithFields(logAuthFields).Errorf("Lock user %v fail: %v", userID, err)
+		return false
+	}
+	_ = redis.DelKV(redis.TagLoginFailAccount, key)
+	addAuditEvent(c, userID, userDB.AuditLoginLocked, fmt.Sprintf("%v failed logins, locked for %v", count, redis.ExpLoginLock))
+
+	logger.WithFields(logAuthFields).Warnf("User %v locked after %v failed logins", userID, count)
+	return true
+}
+
+// recordLoginSuccess 登录成功后清空账户的失败记录，此前失败次数较多时记录为可疑登录
+func recordLoginSuccess(c *fiber.Ctx, userID int64) {
+	key := strconv.FormatInt(userID, 10)
+	accountCount, _, err := redis.GetWindow(redis.TagLoginFailAccount, key, redis.ExpLoginFailWindow)
+	if err != nil {
+		return
+	}
+	ipCount, _, err := redis.GetWindow(redis.TagLoginFailIP, middleware.ClientIP(c), redis.ExpLoginFailWindow)
+	if err != nil {
+		return
+	}
+	if accountCount >= suspiciousFailures || ipCount >= suspiciousFailures {
+		addAuditEvent(c, userID, userDB.AuditLoginSuspicious, fmt.Sprintf("login after %v failures of account and %v failures of ip", accountCount, ipCount))
+	}
+	_ = redis.DelKV(redis.TagLoginFailAccount, key)
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// IssueToken 用户登录并签发 access token 与 refresh token，供无法使用 cookie 的客户端使用
+func IssueToken(c *fiber.Ctx) error {
+	req := new(struct {
+		ID       int64  `json:"id" validate:"required_without=Mobile"`
+		Mobile   string `json:"mobile"`
+		Password string `json:"password" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	u, ok, err := verifyPassword(c, req.ID, req.Mobile, req.Password)
+	if !ok {
+		return err
+	}
+
+	tokens, err := middleware.IssueTokens(c, u.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		ID int64 `json:"id"`
+		*middleware.TokenPair
+	}{
+		ID:        u.ID,
+		TokenPair: tokens,
+	}})
+}
+
+// RefreshToken 使用 refresh token 换取新的 token 对，旧的 refresh token 随即失效
+func RefreshToken(c *fiber.Ctx) error {
+	req := new(struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	tokens, err := middleware.RefreshTokens(c, req.RefreshToken)
+	if err == middleware.ErrRefreshTokenInvalid || err == middleware.ErrRefreshTokenReused {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeRefreshTokenInvalid, Msg: util.MsgWithError(api.MsgRefreshTokenInvalid, err)})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: tokens})
+}
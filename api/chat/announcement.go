@@ -0,0 +1,83 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// SetAnnouncement 修改群公告 api，需要群管理或群主权限，公告为空表示清空
+func SetAnnouncement(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID  int64  `json:"chat_id" validate:"required"`
+		Content string `json:"content" validate:"max=4096"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	announcement, err := chat.SetAnnouncement(db.GetDB(), userID, req.ChatID, req.Content)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyOtherMembers(0, req.ChatID, false, &struct {
+		Type         int64  `json:"type"`
+		ChatID       int64  `json:"chat_id"`
+		EditorID     int64  `json:"editor_id"`
+		Announcement string `json:"announcement"`
+		UpdatedAt    int64  `json:"updated_at"`
+	}{
+		Type:         api.TypeAnnouncementChanged,
+		ChatID:       req.ChatID,
+		EditorID:     userID,
+		Announcement: announcement.Content,
+		UpdatedAt:    announcement.CreatedAt.Unix(),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: announcement})
+}
+
+// GetAnnouncementHistory 获得群公告的修改历史
+func GetAnnouncementHistory(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	history, err := chat.GetAnnouncementHistory(db.GetDB(), req.ChatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		History []chat.ChatAnnouncement `json:"history"`
+	}{
+		History: history,
+	}})
+}
@@ -0,0 +1,172 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/ws"
+)
+
+// GetJoinApplies 获得群聊中待审核的加群申请，需要群管理或群主权限
+func GetJoinApplies(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	applies, err := chat.GetUncertainChatJoinApplies(db.GetDB(), userID, req.ChatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Applies []chat.ChatJoinApply `json:"applies"`
+	}{
+		Applies: applies,
+	}})
+}
+
+// AcceptJoinApply 通过加群申请，需要群管理或群主权限
+func AcceptJoinApply(c *fiber.Ctx) error {
+	req := new(struct {
+		ApplyID int64 `json:"apply_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	apply, err := chat.AcceptChatJoinApply(db.GetDB(), userID, req.ApplyID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatMemberAddFail, Msg: util.MsgWithError(api.MsgChatMemberAddFail, err)})
+	}
+
+	go notifyJoinApplyDecision(apply)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: apply})
+}
+
+// RejectJoinApply 拒绝加群申请，需要群管理或群主权限
+func RejectJoinApply(c *fiber.Ctx) error {
+	req := new(struct {
+		ApplyID int64 `json:"apply_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	apply, err := chat.RejectChatJoinApply(db.GetDB(), userID, req.ApplyID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyJoinApplyDecision(apply)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: apply})
+}
+
+// GetMyJoinApplies 获得自己的加群申请
+func GetMyJoinApplies(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	applies, err := chat.GetChatJoinAppliesByUserID(db.GetDB(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Applies []chat.ChatJoinApply `json:"applies"`
+	}{
+		Applies: applies,
+	}})
+}
+
+// notifyAdmins 向群管理及群主推送通知
+func notifyAdmins(chatID int64, v interface{}) {
+	admins, err := chat.GetChatAdmins(db.GetDB(), chatID)
+	if err != nil {
+		logger := logger2.GetLogger()
+		logger.WithFields(logChatFields).Errorf("websocket to send notification fail for admins of chat %v", chatID)
+		return
+	}
+	for _, admin := range admins {
+		_ = ws.WriteToUser(admin.UserID, v)
+	}
+}
+
+// notifyNewJoinApply 向群管理及群主推送新的加群申请
+func notifyNewJoinApply(apply *chat.ChatJoinApply) {
+	notifyAdmins(apply.ChatID, &struct {
+		Type  int64               `json:"type"`
+		Apply *chat.ChatJoinApply `json:"apply"`
+	}{
+		Type:  api.TypeNewJoinApply,
+		Apply: apply,
+	})
+}
+
+// notifyJoinApplyDecision 向申请人、邀请人及群管理推送加群申请的处理结果
+func notifyJoinApplyDecision(apply *chat.ChatJoinApply) {
+	v := &struct {
+		Type  int64               `json:"type"`
+		Apply *chat.ChatJoinApply `json:"apply"`
+	}{
+		Type:  api.TypeJoinApplyDecision,
+		Apply: apply,
+	}
+	_ = ws.WriteToUser(apply.UserID, v)
+	admins, err := chat.GetChatAdmins(db.GetDB(), apply.ChatID)
+	if err != nil {
+		logger := logger2.GetLogger()
+		logger.WithFields(logChatFields).Errorf("websocket to send notification fail for admins of chat %v", apply.ChatID)
+		return
+	}
+	inviterNotified := apply.InviterID == 0
+	for _, admin := range admins {
+		if admin.UserID == apply.InviterID {
+			inviterNotified = true
+		}
+		_ = ws.WriteToUser(admin.UserID, v)
+	}
+	if !inviterNotified {
+		_ = ws.WriteToUser(apply.InviterID, v)
+	}
+}
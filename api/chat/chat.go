@@ -10,6 +10,8 @@ import (
 	chat2 "github.com/thss-cercis/cercis-server/db/chat"
 	"github.com/thss-cercis/cercis-server/middleware"
 	"github.com/thss-cercis/cercis-server/util"
+	"sort"
+	"time"
 )
 
 var logChatFields = logrus.Fields{
@@ -118,8 +120,96 @@ func GetAllChats(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
 	}
+	unreads, err := chat2.GetAllChatsUnread(db.GetDB(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+	unreadMap := make(map[int64]chat2.ChatUnread)
+	for _, unread := range unreads {
+		unreadMap[unread.ChatID] = unread
+	}
+	memberships, err := chat2.GetAllMemberships(db.GetDB(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+	membershipMap := make(map[int64]chat2.ChatUser)
+	for _, membership := range memberships {
+		membershipMap[membership.ChatID] = membership
+	}
+
+	type resType struct {
+		chat2.Chat
+		LastReadMessageID int64      `json:"last_read_message_id"`
+		UnreadCount       int64      `json:"unread_count"`
+		MuteUntil         *time.Time `json:"mute_until"`
+		Archived          bool       `json:"archived"`
+		TopAt             *time.Time `json:"top_at"`
+	}
+	res := make([]resType, 0)
+	for _, chat := range chats {
+		unread := unreadMap[chat.ID]
+		membership := membershipMap[chat.ID]
+		res = append(res, resType{
+			Chat:              chat,
+			LastReadMessageID: unread.LastReadMessageID,
+			UnreadCount:       unread.UnreadCount,
+			MuteUntil:         membership.MuteUntil,
+			Archived:          membership.Archived,
+			TopAt:             membership.TopAt,
+		})
+	}
+	// 置顶的聊天在前，后置顶的更靠前
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].TopAt == nil || res[j].TopAt == nil {
+			return res[j].TopAt == nil && res[i].TopAt != nil
+		}
+		return res[i].TopAt.After(*res[j].TopAt)
+	})
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: res})
+}
+
+// ModifyChatSettings 修改自己对聊天的免打扰、归档和置顶设置
+func ModifyChatSettings(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+		// MuteUntil 免打扰截止的 unix 时间戳，单位为秒，为 0 表示取消免打扰
+		MuteUntil *int64 `json:"mute_until" validate:"omitempty,gte=0"`
+		Archived  *bool  `json:"archived"`
+		Top       *bool  `json:"top"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	settings := &chat2.MemberSettings{
+		Archived: req.Archived,
+		Top:      req.Top,
+	}
+	if req.MuteUntil != nil {
+		muteUntil := time.Time{}
+		if *req.MuteUntil != 0 {
+			muteUntil = time.Unix(*req.MuteUntil, 0)
+		}
+		settings.MuteUntil = &muteUntil
+	}
 
-	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: chats})
+	chatUser, err := chat2.ModifyMemberSettings(db.GetDB(), req.ChatID, userID, settings)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: chatUser})
 }
 
 // ModifyGroupChat 修改群聊的信息
@@ -128,6 +218,8 @@ func ModifyGroupChat(c *fiber.Ctx) error {
 		ChatID int64  `json:"chat_id"`
 		Name   string `json:"name" validate:"omitempty,min=1"`
 		Avatar string `json:"avatar" validate:"omitempty,url"`
+		// JoinApproval 是否开启加群审核，为 null 表示不修改
+		JoinApproval *bool `json:"join_approval"`
 	})
 
 	if ok, err := api.ParamParserWrap(c, req); !ok {
@@ -164,6 +256,9 @@ func ModifyGroupChat(c *fiber.Ctx) error {
 	if req.Avatar != "" {
 		chat.Avatar = req.Avatar
 	}
+	if req.JoinApproval != nil {
+		chat.JoinApproval = *req.JoinApproval
+	}
 
 	if err := chat.UpdateTo(db.GetDB()); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
@@ -201,7 +296,7 @@ func DeleteChat(c *fiber.Ctx) error {
 // InviteChatMember 邀请新聊天成员的 api
 func InviteChatMember(c *fiber.Ctx) error {
 	// 邀请新的群组人员
-	// 目前不需要对方同意
+	// 群聊开启加群审核时，非管理员的邀请需要群管理同意
 	req := new(struct {
 		ChatID int64 `json:"chat_id" validate:"required"`
 		UserID int64 `json:"user_id" validate:"required"`
@@ -215,16 +310,28 @@ func InviteChatMember(c *fiber.Ctx) error {
 		return err
 	}
 
-	_, ok := middleware.GetUserIDFromSession(c)
+	userID, ok := middleware.GetUserIDFromSession(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
 	}
 
-	if _, err := chat2.AddChatMember(db.GetDB(), req.ChatID, req.UserID); err != nil {
+	chatUser, apply, err := chat2.InviteChatMember(db.GetDB(), userID, req.ChatID, req.UserID)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatMemberAddFail, Msg: util.MsgWithError(api.MsgChatMemberAddFail, err)})
 	}
+	if apply != nil {
+		go notifyNewJoinApply(apply)
+	}
 
-	return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+	return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		// Member 直接加入时的成员表项
+		Member *chat2.ChatUser `json:"member,omitempty"`
+		// Apply 需要审核时的加群申请
+		Apply *chat2.ChatJoinApply `json:"apply,omitempty"`
+	}{
+		Member: chatUser,
+		Apply:  apply,
+	}})
 }
 
 // GetAllChatMembers 获得所有聊天成员
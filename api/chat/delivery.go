@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"encoding/json"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/ws"
+)
+
+// OnNewMessageDelivered 新消息通知写入接收者连接后的回调，记录私聊消息的送达并通知发送者.
+// 撤回同样以新消息的形式通知，但撤回消息本身不记录送达.
+func OnNewMessageDelivered(conn *ws.ConnWrapper, data []byte) {
+	logger := logger2.GetLogger()
+	notification := &struct {
+		Msg struct {
+			ChatID int64 `json:"chat_id"`
+			MsgID  int64 `json:"msg_id"`
+		}
+	}{}
+	if err := json.Unmarshal(data, notification); err != nil {
+		return
+	}
+	chatID, messageID := notification.Msg.ChatID, notification.Msg.MsgID
+
+	// 只统计私聊
+	c, err := chat.GetChat(db.GetDB(), chatID)
+	if err != nil || c.Type != chat.ChatTypePrivate {
+		return
+	}
+	msg, err := chat.GetMessage(db.GetDB(), chatID, conn.UserID, messageID)
+	if err != nil || msg.SenderID == conn.UserID || msg.Type == chat.MsgTypeWithdraw {
+		return
+	}
+	first, err := chat.MarkDelivered(db.GetDB(), chatID, messageID, conn.UserID)
+	if err != nil {
+		logger.WithFields(logMsgFields).Errorf("Mark msg %v of chat %v delivered fail: %v", messageID, chatID, err)
+		return
+	}
+	if first {
+		notifyMessageState(msg.SenderID, chatID, messageID, conn.UserID, chat.DeliveryStateDelivered)
+	}
+}
+
+// notifyMessageState 通知发送者，其消息对 userID 的送达状态发生了变化
+func notifyMessageState(senderID int64, chatID int64, messageID int64, userID int64, state chat.DeliveryState) {
+	err := ws.WriteToUser(senderID, &struct {
+		Type      int64              `json:"type"`
+		ChatID    int64              `json:"chat_id"`
+		MessageID int64              `json:"message_id"`
+		UserID    int64              `json:"user_id"`
+		State     chat.DeliveryState `json:"state"`
+	}{
+		Type:      api.TypeMessageState,
+		ChatID:    chatID,
+		MessageID: messageID,
+		UserID:    userID,
+		State:     state,
+	})
+	if err != nil {
+		logger := logger2.GetLogger()
+		logger.WithFields(logMsgFields).Infof("Send msg state notification fail to user %v", senderID)
+	}
+}
@@ -0,0 +1,424 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/config"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/db/user"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// exportWorkerInterval 后台检查导出任务的间隔
+const exportWorkerInterval = 2 * time.Second
+
+// exportPageSize 导出时每次通过 GetMessages 读取的消息数
+const exportPageSize = 500
+
+// exportStaleTimeout 正在导出的任务超过此时间没有进展时，视为所在实例已经崩溃，重新领取
+const exportStaleTimeout = 5 * time.Minute
+
+// exportCleanupInterval 清理过期导出文件的间隔
+const exportCleanupInterval = time.Hour
+
+// exportRetention 导出文件的保留时间
+const exportRetention = 7 * 24 * time.Hour
+
+// exportMessage 导出文件中的一条消息
+type exportMessage struct {
+	MessageID  int64        `json:"message_id"`
+	SenderID   int64        `json:"sender_id"`
+	SenderName string       `json:"sender_name"`
+	Type       chat.MsgType `json:"type"`
+	// Message 文本消息的内容，已撤回时为空
+	Message string `json:"message,omitempty"`
+	// Payload 非文本消息的结构化内容，媒体以 url 引用
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	ReplyToID int64           `json:"reply_to_id,omitempty"`
+	Withdrawn bool            `json:"withdrawn"`
+	CreatedAt time.Time       `json:"created_at"`
+	EditedAt  *time.Time      `json:"edited_at,omitempty"`
+}
+
+// exportArchive 导出的 json 文件
+type exportArchive struct {
+	ChatID     int64           `json:"chat_id"`
+	ChatType   chat.ChatType   `json:"chat_type"`
+	ChatName   string          `json:"chat_name"`
+	UserID     int64           `json:"user_id"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Messages   []exportMessage `json:"messages"`
+}
+
+// exportHTMLTemplate 导出的静态 html 页面
+var exportHTMLTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"sum":  func(m exportMessage) string { return messageSum(m.Type, m.Message) },
+	"url":  payloadURL,
+	"isImage": func(m exportMessage) bool {
+		return m.Type == chat.MsgTypeImage || m.Type == chat.MsgTypeSticker
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.ChatName}} 聊天记录</title>
+<style>
+body { font-family: sans-serif; max-width: 800px; margin: 0 auto; padding: 16px; }
+.msg { margin: 8px 0; }
+.meta { color: #888; font-size: 12px; }
+.text { white-space: pre-wrap; word-break: break-all; }
+img { max-width: 320px; }
+</style>
+</head>
+<body>
+<h1>{{.ChatName}}</h1>
+<p class="meta">导出于 {{time .ExportedAt}}，共 {{len .Messages}} 条消息</p>
+{{range .Messages}}
+<div class="msg">
+<div class="meta">{{.SenderName}} {{time .CreatedAt}}{{if .EditedAt}}（已编辑）{{end}}</div>
+{{if .Withdrawn}}<div class="meta">[已撤回]</div>
+{{else if eq .Type 0}}<div class="text">{{.Message}}</div>
+{{else if isImage .}}<img src="{{url .}}" alt="{{sum .}}">
+{{else if url .}}<a href="{{url .}}">{{sum .}}</a>
+{{else}}<div>{{sum .}}</div>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// payloadURL 获得消息结构化内容中的 url
+func payloadURL(m exportMessage) string {
+	if m.Payload == nil {
+		return ""
+	}
+	payload := struct {
+		URL string `json:"url"`
+	}{}
+	if err := json.Unmarshal(m.Payload, &payload); err != nil {
+		return ""
+	}
+	return payload.URL
+}
+
+// exportFilePath 获得导出文件的路径，format 为 json 或 html
+func exportFilePath(jobID int64, format string) string {
+	return filepath.Join(config.GetConfig().Export.Dir, fmt.Sprintf("%v.%v", jobID, format))
+}
+
+// StartExportWorker 启动后台任务，逐个处理等待中的导出任务，并定期清理过期的导出文件
+func StartExportWorker() {
+	go func() {
+		ticker := time.NewTicker(exportWorkerInterval)
+		defer ticker.Stop()
+		cleanupTicker := time.NewTicker(exportCleanupInterval)
+		defer cleanupTicker.Stop()
+		cleanupExports()
+		for {
+			select {
+			case <-ticker.C:
+				processExportJobs()
+			case <-cleanupTicker.C:
+				cleanupExports()
+			}
+		}
+	}()
+}
+
+// cleanupExports 删除超过保留时间的导出任务及其文件
+func cleanupExports() {
+	logger := logger2.GetLogger()
+	ids, err := chat.DeleteFinishedExportJobs(db.GetDB(), time.Now().Add(-exportRetention))
+	if err != nil {
+		logger.WithFields(logChatFields).Errorf("Delete finished export jobs fail: %v", err)
+		return
+	}
+	for _, id := range ids {
+		for _, format := range []string{"json", "html"} {
+			if err := os.Remove(exportFilePath(id, format)); err != nil && !os.IsNotExist(err) {
+				logger.WithFields(logChatFields).Warnf("Remove export file of job %v fail: %v", id, err)
+			}
+		}
+	}
+}
+
+// processExportJobs 处理所有等待中的导出任务
+func processExportJobs() {
+	logger := logger2.GetLogger()
+	for {
+		job, err := chat.ClaimExportJob(db.GetDB(), time.Now().Add(-exportStaleTimeout))
+		if err != nil {
+			logger.WithFields(logChatFields).Errorf("Claim export job fail: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		count, err := runExportJob(job)
+		if err != nil {
+			logger.WithFields(logChatFields).Warnf("Export job %v fail: %v", job.ID, err)
+		}
+		if err := chat.FinishExportJob(db.GetDB(), job, count, err); err != nil {
+			logger.WithFields(logChatFields).Errorf("Finish export job %v fail: %v", job.ID, err)
+		}
+	}
+}
+
+// exportSenderNames 导出时解析发送者的名称，依次使用群内备注、好友备注和昵称
+type exportSenderNames struct {
+	userID  int64
+	aliases map[int64]string
+	names   map[int64]string
+}
+
+func newExportSenderNames(chatID int64, userID int64) (*exportSenderNames, error) {
+	members, err := chat.GetChatMembers(db.GetDB(), chatID)
+	if err != nil {
+		return nil, err
+	}
+	aliases := make(map[int64]string)
+	for _, member := range members {
+		aliases[member.UserID] = member.Alias
+	}
+	return &exportSenderNames{userID: userID, aliases: aliases, names: make(map[int64]string)}, nil
+}
+
+func (n *exportSenderNames) get(senderID int64) string {
+	if name, ok := n.names[senderID]; ok {
+		return name
+	}
+	name := n.aliases[senderID]
+	if name == "" {
+		friendEntry, err := user.GetFriendEntry(db.GetDB(), n.userID, senderID)
+		if err == nil && friendEntry != nil && friendEntry.Alias != "" {
+			name = friendEntry.Alias
+		}
+	}
+	if name == "" {
+		if u, err := user.GetUserByID(db.GetDB(), senderID); err == nil {
+			name = u.NickName
+		} else {
+			name = strconv.FormatInt(senderID, 10)
+		}
+	}
+	n.names[senderID] = name
+	return name
+}
+
+// runExportJob 执行导出任务，只导出请求者作为成员期间的消息，阅后即焚的消息不会导出，返回导出的消息数
+func runExportJob(job *chat.ExportJob) (int64, error) {
+	group, err := chat.GetChat(db.GetDB(), job.ChatID)
+	if err != nil {
+		return 0, err
+	}
+	intervals, err := chat.GetMembershipIntervals(db.GetDB(), job.ChatID, job.UserID)
+	if err != nil {
+		return 0, err
+	}
+	latest, err := chat.GetLatestMessages(db.GetDB(), job.UserID, []int64{job.ChatID})
+	if err != nil {
+		return 0, err
+	}
+	names, err := newExportSenderNames(job.ChatID, job.UserID)
+	if err != nil {
+		return 0, err
+	}
+	var maxID int64
+	if len(latest) != 0 {
+		maxID = latest[0].MessageID
+	}
+
+	archive := &exportArchive{
+		ChatID:     group.ID,
+		ChatType:   group.Type,
+		ChatName:   group.Name,
+		UserID:     job.UserID,
+		ExportedAt: time.Now(),
+		Messages:   make([]exportMessage, 0),
+	}
+	withdrawn := make(map[int64]bool)
+	for fromID := int64(1); fromID <= maxID; fromID += exportPageSize {
+		if err := chat.TouchExportJob(db.GetDB(), job.ID); err != nil {
+			return 0, err
+		}
+		msgs, err := chat.GetMessages(db.GetDB(), job.ChatID, job.UserID, fromID, fromID+exportPageSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, msg := range msgs {
+			if msg.Type == chat.MsgTypeWithdraw {
+				if id, err := strconv.ParseInt(msg.Message, 10, 64); err == nil {
+					withdrawn[id] = true
+				}
+				continue
+			}
+			// 阅后即焚的消息不应留下永久的副本
+			if msg.BurnAfter > 0 {
+				continue
+			}
+			if !inMembershipIntervals(intervals, msg.CreatedAt) {
+				continue
+			}
+			item := exportMessage{
+				MessageID:  msg.MessageID,
+				SenderID:   msg.SenderID,
+				SenderName: names.get(msg.SenderID),
+				Type:       msg.Type,
+				ReplyToID:  msg.ReplyToID,
+				CreatedAt:  msg.CreatedAt,
+				EditedAt:   msg.EditedAt,
+			}
+			if _, ok := msgPayloadSchemas[msg.Type]; ok && json.Valid([]byte(msg.Message)) {
+				item.Payload = json.RawMessage(msg.Message)
+			} else {
+				item.Message = msg.Message
+			}
+			archive.Messages = append(archive.Messages, item)
+		}
+	}
+	// 撤回消息总在被撤回的消息之后，最后统一标记
+	for i := range archive.Messages {
+		if withdrawn[archive.Messages[i].MessageID] {
+			archive.Messages[i].Withdrawn = true
+			archive.Messages[i].Message = ""
+			archive.Messages[i].Payload = nil
+		}
+	}
+
+	if err := writeExportFiles(job.ID, archive); err != nil {
+		return 0, err
+	}
+	return int64(len(archive.Messages)), nil
+}
+
+// inMembershipIntervals 判断某个时间是否在任意一段成员时间内
+func inMembershipIntervals(intervals []chat.MembershipInterval, t time.Time) bool {
+	for i := range intervals {
+		if intervals[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeExportFiles 写入 json 与 html 导出文件
+func writeExportFiles(jobID int64, archive *exportArchive) error {
+	if err := os.MkdirAll(config.GetConfig().Export.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(exportFilePath(jobID, "json"), data, 0644); err != nil {
+		return err
+	}
+	f, err := os.Create(exportFilePath(jobID, "html"))
+	if err != nil {
+		return err
+	}
+	if err := exportHTMLTemplate.Execute(f, archive); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CreateExportJob 创建聊天记录的导出任务 api
+func CreateExportJob(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	job, err := chat.CreateExportJob(db.GetDB(), userID, req.ChatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: job})
+}
+
+// GetExportJob 查询导出任务状态 api
+func GetExportJob(c *fiber.Ctx) error {
+	req := new(struct {
+		JobID int64 `json:"job_id" query:"job_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	job, err := chat.GetExportJob(db.GetDB(), userID, req.JobID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: job})
+}
+
+// DownloadExport 下载导出文件 api，format 为 json 或 html
+func DownloadExport(c *fiber.Ctx) error {
+	req := new(struct {
+		JobID  int64  `json:"job_id" query:"job_id" validate:"required"`
+		Format string `json:"format" query:"format" validate:"required,oneof=json html"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	job, err := chat.GetExportJob(db.GetDB(), userID, req.JobID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+	if job.State != chat.ExportStateDone {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, errors.New("the export job is not done"))})
+	}
+
+	return c.Download(exportFilePath(job.ID, req.Format), fmt.Sprintf("chat-%v-%v.%v", job.ChatID, job.ID, req.Format))
+}
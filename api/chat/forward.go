@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// ForwardMessages 转发消息 api，merge 为 true 时合并为一条聊天记录转发
+func ForwardMessages(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID        int64   `json:"chat_id" validate:"required"`
+		MessageIDs    []int64 `json:"message_ids" validate:"required,min=1,max=100,unique"`
+		TargetChatIDs []int64 `json:"target_chat_ids" validate:"required,min=1,max=20,unique"`
+		Merge         bool    `json:"merge"`
+		// Title 合并转发的标题
+		Title string `json:"title" validate:"max=127"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	var msgs []*chat.Message
+	var err error
+	if req.Merge {
+		msgs, err = chat.MergeForwardMessages(db.GetDB(), userID, req.ChatID, req.MessageIDs, req.TargetChatIDs, req.Title)
+	} else {
+		msgs, err = chat.ForwardMessages(db.GetDB(), userID, req.ChatID, req.MessageIDs, req.TargetChatIDs)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(addMessageErrorRes(err))
+	}
+
+	// websocket
+	for _, msg := range msgs {
+		go notifyNewMessage(userID, msg, messageSum(msg.Type, msg.Message))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Messages []*chat.Message `json:"messages"`
+	}{
+		Messages: msgs,
+	}})
+}
+
+// GetMergedForwardItems 展开合并转发消息 api
+func GetMergedForwardItems(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID    int64 `json:"chat_id" query:"chat_id" validate:"required"`
+		MessageID int64 `json:"message_id" query:"message_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	items, err := chat.GetMergedForwardItems(db.GetDB(), req.ChatID, userID, req.MessageID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Items []chat.MergedForwardItem `json:"items"`
+	}{
+		Items: items,
+	}})
+}
@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"time"
+)
+
+// CreateInvite 创建群聊邀请链接 api，需要群管理或群主权限
+func CreateInvite(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+		// ExpireIn 多少秒后过期，为 0 表示永不过期
+		ExpireIn        int64 `json:"expire_in" validate:"gte=0"`
+		MaxUses         int64 `json:"max_uses" validate:"gte=0"`
+		RequireApproval bool  `json:"require_approval"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	opt := &chat.InviteOption{
+		MaxUses:         req.MaxUses,
+		RequireApproval: req.RequireApproval,
+	}
+	if req.ExpireIn != 0 {
+		expireAt := time.Now().Add(time.Duration(req.ExpireIn) * time.Second)
+		opt.ExpireAt = &expireAt
+	}
+
+	invite, err := chat.CreateChatInvite(db.GetDB(), userID, req.ChatID, opt)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: invite})
+}
+
+// RevokeInvite 撤销群聊邀请链接 api，需要群管理或群主权限
+func RevokeInvite(c *fiber.Ctx) error {
+	req := new(struct {
+		InviteID int64 `json:"invite_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	invite, err := chat.RevokeChatInvite(db.GetDB(), userID, req.InviteID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: invite})
+}
+
+// GetInvites 获得群聊所有邀请链接 api，需要群管理或群主权限
+func GetInvites(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	invites, err := chat.GetChatInvites(db.GetDB(), userID, req.ChatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Invites []chat.ChatInvite `json:"invites"`
+	}{
+		Invites: invites,
+	}})
+}
+
+// GetInviteInfo 通过邀请码预览群聊信息
+func GetInviteInfo(c *fiber.Ctx) error {
+	req := new(struct {
+		Code string `json:"code" query:"code" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	invite, err := chat.GetChatInviteByCode(db.GetDB(), req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+	group, err := chat.GetChat(db.GetDB(), invite.ChatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		ChatID          int64  `json:"chat_id"`
+		Name            string `json:"name"`
+		Avatar          string `json:"avatar"`
+		RequireApproval bool   `json:"require_approval"`
+	}{
+		ChatID:          group.ID,
+		Name:            group.Name,
+		Avatar:          group.Avatar,
+		RequireApproval: invite.RequireApproval,
+	}})
+}
+
+// JoinByInvite 通过邀请码加入群聊，邀请需要审核时会创建加群申请
+func JoinByInvite(c *fiber.Ctx) error {
+	req := new(struct {
+		Code   string `json:"code" validate:"required"`
+		Remark string `json:"remark" validate:"max=255"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	chatUser, apply, err := chat.JoinChatByInvite(db.GetDB(), userID, req.Code, req.Remark)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatMemberAddFail, Msg: util.MsgWithError(api.MsgChatMemberAddFail, err)})
+	}
+	if apply != nil {
+		go notifyNewJoinApply(apply)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		// Member 直接加入时的成员表项
+		Member *chat.ChatUser `json:"member,omitempty"`
+		// Apply 需要审核时的加群申请
+		Apply *chat.ChatJoinApply `json:"apply,omitempty"`
+	}{
+		Member: chatUser,
+		Apply:  apply,
+	}})
+}
@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/ws"
+)
+
+// GetUnreadMentions 获得自己尚未读到的提及，chat_id 为 0 时获得所有聊天中的提及
+func GetUnreadMentions(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	mentions, err := chat.GetUnreadMentions(db.GetDB(), userID, req.ChatID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Mentions []chat.MessageMention `json:"mentions"`
+	}{
+		Mentions: mentions,
+	}})
+}
+
+// notifyMentions 向被提及的成员推送提及事件，免打扰的成员也会收到.
+// senderUsernames 为每个成员看到的发送者名称.
+func notifyMentions(msg *chat.Message, senderUsernames map[int64]string, sum string) {
+	for _, userID := range msg.Mentions {
+		_ = ws.WriteToUser(userID, &struct {
+			Type           int64  `json:"type"`
+			ChatID         int64  `json:"chat_id"`
+			MessageID      int64  `json:"message_id"`
+			SenderID       int64  `json:"sender_id"`
+			SenderUsername string `json:"sender_username"`
+			Sum            string `json:"sum"`
+		}{
+			Type:           api.TypeMention,
+			ChatID:         msg.ChatID,
+			MessageID:      msg.MessageID,
+			SenderID:       msg.SenderID,
+			SenderUsername: senderUsernames[userID],
+			Sum:            sum,
+		})
+	}
+}
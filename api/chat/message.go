@@ -1,16 +1,21 @@
 package chat
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/sirupsen/logrus"
 	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/config"
 	"github.com/thss-cercis/cercis-server/db"
 	"github.com/thss-cercis/cercis-server/db/chat"
 	"github.com/thss-cercis/cercis-server/db/user"
 	logger2 "github.com/thss-cercis/cercis-server/logger"
 	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/redis"
 	"github.com/thss-cercis/cercis-server/util"
 	"github.com/thss-cercis/cercis-server/ws"
+	"time"
 )
 
 var logMsgFields = logrus.Fields{
@@ -18,13 +23,28 @@ var logMsgFields = logrus.Fields{
 	"api":    true,
 }
 
+// addMessageReq 发送消息的请求，http 与 websocket 共用
+type addMessageReq struct {
+	ChatID  int64        `json:"chat_id" validate:"required"`
+	Type    chat.MsgType `json:"type" validate:"oneof=0 1 2 3 4 6 7 8"`
+	Message string       `json:"message" validate:"min=1"`
+	// ReplyToID 回复的消息 id，为 0 表示不是回复
+	ReplyToID int64 `json:"reply_to_id" validate:"gte=0"`
+	// BurnAfter 阅后即焚的秒数，为 0 表示不焚毁，最长 7 天
+	BurnAfter int64 `json:"burn_after" validate:"gte=0,lte=604800"`
+	// MentionIDs 提及的成员，任意类型的消息都可以使用，文本消息中的 <@id> 也会计入
+	MentionIDs []int64 `json:"mention_ids" validate:"max=100,dive,gt=0"`
+}
+
+// withdrawMessageReq 撤回消息的请求，http 与 websocket 共用
+type withdrawMessageReq struct {
+	ChatID    int64 `json:"chat_id" validate:"required"`
+	MessageID int64 `json:"message_id" validate:"required"`
+}
+
 // AddMessage 添加新消息 api
 func AddMessage(c *fiber.Ctx) error {
-	req := new(struct {
-		ChatID  int64        `json:"chat_id" validate:"required"`
-		Type    chat.MsgType `json:"type" validate:"gte=0,lte=5"`
-		Message string       `json:"message" validate:"min=1"`
-	})
+	req := new(addMessageReq)
 
 	if ok, err := api.ParamParserWrap(c, req); !ok {
 		return err
@@ -39,76 +59,212 @@ func AddMessage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
 	}
 
-	msg, err := chat.CreateMessage(db.GetDB(), req.ChatID, userID, req.Type, req.Message)
+	message, err := normalizeMessagePayload(req.Type, req.Message)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, err)})
+	}
+	req.Message = message
+
+	msg, err := addMessage(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(addMessageErrorRes(err))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg})
+}
+
+// addMessage 以 userID 的身份发送消息，并通过 websocket 通知聊天成员
+func addMessage(userID int64, req *addMessageReq) (*chat.Message, error) {
+	msg, err := chat.CreateMessageWithOption(db.GetDB(), req.ChatID, userID, req.Type, req.Message, chat.MsgOption{
+		ReplyToID:  req.ReplyToID,
+		BurnAfter:  req.BurnAfter,
+		MentionIDs: req.MentionIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// websocket，文本消息截取前 30 个字
+	go notifyNewMessage(userID, msg, messageSum(msg.Type, msg.Message))
+
+	return msg, nil
+}
+
+// addMessageErrorRes 将发送消息失败的错误转为回复，被禁言时使用单独的错误码
+func addMessageErrorRes(err error) api.BaseRes {
+	if errors.Is(err, chat.ErrMemberSilenced) {
+		return api.BaseRes{Code: api.CodeChatMemberSilenced, Msg: util.MsgWithError(api.MsgChatMemberSilenced, err)}
+	}
+	return api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)}
+}
+
+// withdrawMessage 以 userID 的身份撤回消息，并通过 websocket 通知聊天成员
+func withdrawMessage(userID int64, req *withdrawMessageReq) (*chat.Message, error) {
+	msg, err := chat.WithdrawMessage(db.GetDB(), req.ChatID, userID, req.MessageID)
+	if err != nil {
+		return nil, err
 	}
 
 	// websocket
+	go notifyNewMessage(userID, msg, msg.Message)
+
+	return msg, nil
+}
+
+// markReadReq 标记已读的请求，http 与 websocket 共用
+type markReadReq struct {
+	ChatID    int64 `json:"chat_id" validate:"required"`
+	MessageID int64 `json:"message_id" validate:"required"`
+}
+
+// markRead 推进 userID 的已读位置，并通过 websocket 通知聊天的其他成员，返回推进后的已读位置
+func markRead(userID int64, req *markReadReq) (int64, error) {
+	lastRead, advanced, err := chat.MarkRead(db.GetDB(), req.ChatID, userID, req.MessageID)
+	if err != nil {
+		return 0, err
+	}
+	// 已读位置没有前进时无需通知
+	if !advanced {
+		return lastRead, nil
+	}
+
+	// 私聊中通知对方消息已读
 	go func() {
-		chatMembers, err := chat.GetChatMembers(db.GetDB(), req.ChatID)
+		c, err := chat.GetChat(db.GetDB(), req.ChatID)
+		if err != nil || c.Type != chat.ChatTypePrivate {
+			return
+		}
+		members, err := chat.GetChatMembers(db.GetDB(), req.ChatID)
 		if err != nil {
-			logger := logger2.GetLogger()
-			logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", req.ChatID)
 			return
 		}
-		// 找到聊天中发消息人的 ChatUser 项
-		var senderChatUser *chat.ChatUser
-		for _, chatMember := range chatMembers {
-			if chatMember.UserID == userID {
-				senderChatUser = &chatMember
+		for _, member := range members {
+			if member.UserID != userID {
+				notifyMessageState(member.UserID, req.ChatID, lastRead, userID, chat.DeliveryStateRead)
 			}
 		}
-		// 找到发送人的 User 项
-		senderUser, err := user.GetUserByID(db.GetDB(), userID)
-		if err != nil {
-			logger := logger2.GetLogger()
-			logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", req.ChatID)
-			return
+	}()
+
+	// websocket
+	go notifyOtherMembers(userID, req.ChatID, false, &struct {
+		Type      int64 `json:"type"`
+		ChatID    int64 `json:"chat_id"`
+		UserID    int64 `json:"user_id"`
+		MessageID int64 `json:"message_id"`
+	}{
+		Type:      api.TypeReadPosition,
+		ChatID:    req.ChatID,
+		UserID:    userID,
+		MessageID: lastRead,
+	})
+
+	return lastRead, nil
+}
+
+// typingExpire 正在输入事件的有效期，客户端应在过期后自动清除提示
+const typingExpire = 6 * time.Second
+
+// typingReq 正在输入的请求，http 与 websocket 共用
+type typingReq struct {
+	ChatID int64 `json:"chat_id" validate:"required"`
+}
+
+// typing 通知聊天的其他成员 userID 正在输入，不写入数据库. 过于频繁的调用会被忽略，sent 表示是否实际推送.
+func typing(userID int64, req *typingReq) (sent bool, err error) {
+	if !chat.CheckIfInChat(db.GetDB(), req.ChatID, userID) {
+		return false, errors.New("user is not in the chat")
+	}
+	ok, err := redis.PutKVIfAbsent(redis.TagChatTyping, fmt.Sprintf("%v_%v", req.ChatID, userID), "1", redis.ExpChatTyping)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	// websocket
+	go notifyOtherMembers(userID, req.ChatID, true, &struct {
+		Type     int64 `json:"type"`
+		ChatID   int64 `json:"chat_id"`
+		UserID   int64 `json:"user_id"`
+		ExpireAt int64 `json:"expire_at"`
+	}{
+		Type:     api.TypeTyping,
+		ChatID:   req.ChatID,
+		UserID:   userID,
+		ExpireAt: time.Now().Add(typingExpire).Unix(),
+	})
+
+	return true, nil
+}
+
+// notifyNewMessage 向聊天的所有成员推送新消息通知，sum 为通知中的消息摘要
+func notifyNewMessage(userID int64, msg *chat.Message, sum string) {
+	logger := logger2.GetLogger()
+	chatMembers, err := chat.GetChatMembers(db.GetDB(), msg.ChatID)
+	if err != nil {
+		logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", msg.ChatID)
+		return
+	}
+	// 找到聊天中发消息人的 ChatUser 项
+	var senderChatUser *chat.ChatUser
+	for i := range chatMembers {
+		if chatMembers[i].UserID == userID {
+			senderChatUser = &chatMembers[i]
 		}
-		// 截取前 30 个字
-		sum := util.FirstNCharOfString(req.Message, 30)
-		for _, chatMember := range chatMembers {
-			// 获得消息通知中的名称
-			var senderUsername string
-			if senderChatUser != nil && senderChatUser.Alias != "" {
-				senderUsername = senderChatUser.Alias
+	}
+	// 找到发送人的 User 项
+	senderUser, err := user.GetUserByID(db.GetDB(), userID)
+	if err != nil {
+		logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", msg.ChatID)
+		return
+	}
+	now := time.Now()
+	senderUsernames := make(map[int64]string)
+	for _, chatMember := range chatMembers {
+		// 获得消息通知中的名称
+		var senderUsername string
+		if senderChatUser != nil && senderChatUser.Alias != "" {
+			senderUsername = senderChatUser.Alias
+		} else {
+			// 获得好友项
+			friendEntry, err := user.GetFriendEntry(db.GetDB(), chatMember.UserID, userID)
+			if err == nil && friendEntry != nil && friendEntry.Alias != "" {
+				senderUsername = friendEntry.Alias
 			} else {
-				// 获得好友项
-				friendEntry, err := user.GetFriendEntry(db.GetDB(), chatMember.UserID, userID)
-				if err != nil && friendEntry != nil && friendEntry.Alias != "" {
-					senderUsername = friendEntry.Alias
-				} else {
-					senderUsername = senderUser.NickName
-				}
+				senderUsername = senderUser.NickName
 			}
-			// 写入消息
-			err := ws.WriteToUser(chatMember.UserID, &struct {
-				Type int64 `json:"type"`
-				Msg  struct {
-					ChatID         int64        `json:"chat_id"`
-					MsgID          int64        `json:"msg_id"`
-					Type           chat.MsgType `json:"type"`
-					SenderUsername string       `json:"sender_username"`
-					Sum            string       `json:"sum"`
-				}
-			}{
-				Type: api.TypeAddNewMessage,
-				Msg: struct {
-					ChatID         int64        `json:"chat_id"`
-					MsgID          int64        `json:"msg_id"`
-					Type           chat.MsgType `json:"type"`
-					SenderUsername string       `json:"sender_username"`
-					Sum            string       `json:"sum"`
-				}{ChatID: msg.ChatID, MsgID: msg.MessageID, Type: msg.Type, SenderUsername: senderUsername, Sum: sum},
-			})
-			if err != nil {
-				continue
+		}
+		senderUsernames[chatMember.UserID] = senderUsername
+		// 写入消息，免打扰的成员仍然收到事件，但客户端不应提醒
+		err := ws.WriteToUser(chatMember.UserID, &struct {
+			Type   int64 `json:"type"`
+			Silent bool  `json:"silent"`
+			Msg    struct {
+				ChatID         int64        `json:"chat_id"`
+				MsgID          int64        `json:"msg_id"`
+				Type           chat.MsgType `json:"type"`
+				SenderUsername string       `json:"sender_username"`
+				Sum            string       `json:"sum"`
 			}
+		}{
+			Type:   api.TypeAddNewMessage,
+			Silent: chatMember.IsMuted(now),
+			Msg: struct {
+				ChatID         int64        `json:"chat_id"`
+				MsgID          int64        `json:"msg_id"`
+				Type           chat.MsgType `json:"type"`
+				SenderUsername string       `json:"sender_username"`
+				Sum            string       `json:"sum"`
+			}{ChatID: msg.ChatID, MsgID: msg.MessageID, Type: msg.Type, SenderUsername: senderUsername, Sum: sum},
+		})
+		if err != nil {
+			continue
 		}
-	}()
-
-	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg})
+	}
+	if len(msg.Mentions) != 0 {
+		notifyMentions(msg, senderUsernames, sum)
+	}
 }
 
 // GetMessage 查询一条消息 api
@@ -136,7 +292,23 @@ func GetMessage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg})
+	type resType struct {
+		*chat.Message
+		// 私聊消息的送达状态
+		State      *chat.DeliveryState      `json:"state,omitempty"`
+		Recipients []chat.RecipientDelivery `json:"recipients,omitempty"`
+	}
+	res := resType{Message: msg}
+	if ch, err := chat.GetChat(db.GetDB(), req.ChatID); err == nil && ch.Type == chat.ChatTypePrivate {
+		state, recipients, err := chat.GetMessageDelivery(db.GetDB(), msg)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+		}
+		res.State = &state
+		res.Recipients = recipients
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: res})
 }
 
 // GetMessages 查询一堆消息 api
@@ -212,9 +384,93 @@ func GetAllChatsLatestMessageID(c *fiber.Ctx) error {
 
 // WithdrawMessage 撤回一条消息 api
 func WithdrawMessage(c *fiber.Ctx) error {
+	req := new(withdrawMessageReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	msg, err := withdrawMessage(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg})
+}
+
+// MarkRead 推进自己在聊天中的已读位置 api
+func MarkRead(c *fiber.Ctx) error {
+	req := new(markReadReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	lastRead, err := markRead(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		LastReadMessageID int64 `json:"last_read_message_id"`
+	}{
+		LastReadMessageID: lastRead,
+	}})
+}
+
+// Typing 通知聊天的其他成员自己正在输入 api
+func Typing(c *fiber.Ctx) error {
+	req := new(typingReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	sent, err := typing(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Sent bool `json:"sent"`
+	}{
+		Sent: sent,
+	}})
+}
+
+// EditMessage 编辑一条消息 api
+func EditMessage(c *fiber.Ctx) error {
 	req := new(struct {
-		ChatID    int64 `json:"chat_id" validate:"required"`
-		MessageID int64 `json:"message_id" validate:"required"`
+		ChatID    int64  `json:"chat_id" validate:"required"`
+		MessageID int64  `json:"message_id" validate:"required"`
+		Message   string `json:"message" validate:"min=1"`
 	})
 
 	if ok, err := api.ParamParserWrap(c, req); !ok {
@@ -230,71 +486,82 @@ func WithdrawMessage(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
 	}
 
-	msg, err := chat.WithdrawMessage(db.GetDB(), req.ChatID, userID, req.MessageID)
+	window := time.Duration(config.GetConfig().Chat.EditWindow) * time.Second
+	msg, err := chat.EditMessage(db.GetDB(), req.ChatID, userID, req.MessageID, req.Message, window)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
 	}
 
 	// websocket
-	go func() {
-		chatMembers, err := chat.GetChatMembers(db.GetDB(), req.ChatID)
-		if err != nil {
-			logger := logger2.GetLogger()
-			logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", req.ChatID)
-			return
-		}
-		// 找到聊天中发消息人的 ChatUser 项
-		var senderChatUser *chat.ChatUser
-		for _, chatMember := range chatMembers {
-			if chatMember.UserID == userID {
-				senderChatUser = &chatMember
-			}
-		}
-		// 找到发送人的 User 项
-		senderUser, err := user.GetUserByID(db.GetDB(), userID)
-		if err != nil {
-			logger := logger2.GetLogger()
-			logger.WithFields(logMsgFields).Errorf("websocket to send msg notification fail for chat %v", req.ChatID)
-			return
-		}
-		for _, chatMember := range chatMembers {
-			// 获得消息通知中的名称
-			var senderUsername string
-			if senderChatUser != nil && senderChatUser.Alias != "" {
-				senderUsername = senderChatUser.Alias
-			} else {
-				// 获得好友项
-				friendEntry, err := user.GetFriendEntry(db.GetDB(), chatMember.UserID, userID)
-				if err != nil && friendEntry != nil && friendEntry.Alias != "" {
-					senderUsername = friendEntry.Alias
-				} else {
-					senderUsername = senderUser.NickName
-				}
-			}
-			err := ws.WriteToUser(chatMember.UserID, &struct {
-				Type int64 `json:"type"`
-				Msg  struct {
-					ChatID         int64        `json:"chat_id"`
-					MsgID          int64        `json:"msg_id"`
-					Type           chat.MsgType `json:"type"`
-					SenderUsername string       `json:"sender_username"`
-					Sum            string       `json:"sum"`
-				}
-			}{
-				Type: api.TypeAddNewMessage,
-				Msg: struct {
-					ChatID         int64        `json:"chat_id"`
-					MsgID          int64        `json:"msg_id"`
-					Type           chat.MsgType `json:"type"`
-					SenderUsername string       `json:"sender_username"`
-					Sum            string       `json:"sum"`
-				}{ChatID: msg.ChatID, MsgID: msg.MessageID, Type: msg.Type, SenderUsername: senderUsername, Sum: msg.Message},
-			})
-			if err != nil {
-				continue
-			}
-		}
-	}()
+	go notifyOtherMembers(0, msg.ChatID, false, &struct {
+		Type      int64  `json:"type"`
+		ChatID    int64  `json:"chat_id"`
+		MessageID int64  `json:"message_id"`
+		Sum       string `json:"sum"`
+		EditedAt  int64  `json:"edited_at"`
+	}{
+		Type:      api.TypeEditMessage,
+		ChatID:    msg.ChatID,
+		MessageID: msg.MessageID,
+		Sum:       util.FirstNCharOfString(msg.Message, 30),
+		EditedAt:  msg.EditedAt.Unix(),
+	})
 
 	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg})
 }
+
+// GetMessageRevisions 查询一条消息的历史版本 api
+func GetMessageRevisions(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID    int64 `json:"chat_id" query:"chat_id" validate:"required"`
+		MessageID int64 `json:"message_id" query:"message_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	revisions, err := chat.GetMessageRevisions(db.GetDB(), req.ChatID, userID, req.MessageID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: revisions})
+}
+
+// GetReplies 查询回复了某条消息的所有消息 api
+func GetReplies(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID    int64 `json:"chat_id" query:"chat_id" validate:"required"`
+		MessageID int64 `json:"message_id" query:"message_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	messages, err := chat.GetReplies(db.GetDB(), req.ChatID, userID, req.MessageID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: messages})
+}
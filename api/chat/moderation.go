@@ -0,0 +1,206 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/ws"
+	"time"
+)
+
+// moderationLogsDefaultLimit 未指定 limit 时单次返回的管理日志条数
+const moderationLogsDefaultLimit = 50
+
+// SilenceMember 禁言群成员 api，until 为禁言截止的 unix 时间戳，单位为秒，为 0 表示解除禁言
+func SilenceMember(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+		UserID int64 `json:"user_id" validate:"required"`
+		Until  int64 `json:"until" validate:"gte=0"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	until := time.Time{}
+	action := chat.ActionUnsilence
+	if req.Until != 0 {
+		until = time.Unix(req.Until, 0)
+		action = chat.ActionSilence
+	}
+	if err := chat.SilenceMember(db.GetDB(), userID, req.ChatID, req.UserID, until); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyMemberModerated(req.ChatID, userID, req.UserID, action, req.Until)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// BanMember 移出群成员并禁止其重新加入 api，until 为截止的 unix 时间戳，单位为秒，为 0 表示永久禁止
+func BanMember(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+		UserID int64 `json:"user_id" validate:"required"`
+		Until  int64 `json:"until" validate:"gte=0"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	var until *time.Time
+	if req.Until != 0 {
+		t := time.Unix(req.Until, 0)
+		until = &t
+	}
+	if err := chat.BanMember(db.GetDB(), userID, req.ChatID, req.UserID, until); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyMemberModerated(req.ChatID, userID, req.UserID, chat.ActionBan, req.Until)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// UnbanMember 解除禁止加入 api
+func UnbanMember(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" validate:"required"`
+		UserID int64 `json:"user_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.UnbanMember(db.GetDB(), userID, req.ChatID, req.UserID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// SetMuteAll 开启或关闭全员禁言 api
+func SetMuteAll(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID  int64 `json:"chat_id" validate:"required"`
+		MuteAll bool  `json:"mute_all"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.SetMuteAll(db.GetDB(), userID, req.ChatID, req.MuteAll); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	action := chat.ActionUnmuteAll
+	if req.MuteAll {
+		action = chat.ActionMuteAll
+	}
+	go notifyMemberModerated(req.ChatID, userID, 0, action, 0)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// GetModerationLogs 获得群聊的管理日志 api，只有群主可以查询
+func GetModerationLogs(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID   int64 `json:"chat_id" query:"chat_id" validate:"required"`
+		BeforeID int64 `json:"before_id" query:"before_id"`
+		Limit    int   `json:"limit" query:"limit" validate:"gte=0,lte=200"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = moderationLogsDefaultLimit
+	}
+	logs, err := chat.GetModerationLogs(db.GetDB(), userID, req.ChatID, req.BeforeID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Logs []chat.ModerationLog `json:"logs"`
+	}{
+		Logs: logs,
+	}})
+}
+
+// notifyMemberModerated 向群成员推送管理操作，被移出的成员也会收到
+func notifyMemberModerated(chatID int64, operatorID int64, targetID int64, action chat.ModerationAction, until int64) {
+	v := &struct {
+		Type       int64                 `json:"type"`
+		ChatID     int64                 `json:"chat_id"`
+		OperatorID int64                 `json:"operator_id"`
+		TargetID   int64                 `json:"target_id"`
+		Action     chat.ModerationAction `json:"action"`
+		Until      int64                 `json:"until"`
+	}{
+		Type:       api.TypeMemberModerated,
+		ChatID:     chatID,
+		OperatorID: operatorID,
+		TargetID:   targetID,
+		Action:     action,
+		Until:      until,
+	}
+	notifyOtherMembers(0, chatID, false, v)
+	if action == chat.ActionBan {
+		_ = ws.WriteToUser(targetID, v)
+	}
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/util/validator"
+)
+
+// imagePayload 图片消息的内容
+type imagePayload struct {
+	URL    string `json:"url" validate:"required,url"`
+	Width  int64  `json:"width" validate:"required,gt=0"`
+	Height int64  `json:"height" validate:"required,gt=0"`
+}
+
+// audioPayload 音频消息的内容，Duration 单位为秒
+type audioPayload struct {
+	URL      string  `json:"url" validate:"required,url"`
+	Duration float64 `json:"duration" validate:"required,gt=0"`
+}
+
+// videoPayload 视频消息的内容，Duration 单位为秒
+type videoPayload struct {
+	URL      string  `json:"url" validate:"required,url"`
+	Duration float64 `json:"duration" validate:"required,gt=0"`
+	Width    int64   `json:"width" validate:"required,gt=0"`
+	Height   int64   `json:"height" validate:"required,gt=0"`
+	Cover    string  `json:"cover" validate:"omitempty,url"`
+}
+
+// geoPayload 位置消息的内容
+type geoPayload struct {
+	Lat   *float64 `json:"lat" validate:"required,gte=-90,lte=90"`
+	Lng   *float64 `json:"lng" validate:"required,gte=-180,lte=180"`
+	Title string   `json:"title" validate:"max=127"`
+}
+
+// filePayload 文件消息的内容，Size 单位为字节
+type filePayload struct {
+	URL  string `json:"url" validate:"required,url"`
+	Name string `json:"name" validate:"required,max=255"`
+	Size int64  `json:"size" validate:"gte=0"`
+}
+
+// contactPayload 名片消息的内容
+type contactPayload struct {
+	UserID int64 `json:"user_id" validate:"required"`
+}
+
+// stickerPayload 表情包消息的内容
+type stickerPayload struct {
+	ID     string `json:"id" validate:"required,max=63"`
+	URL    string `json:"url" validate:"required,url"`
+	Width  int64  `json:"width" validate:"gte=0"`
+	Height int64  `json:"height" validate:"gte=0"`
+}
+
+// msgPayloadSchemas 各消息种类的内容结构，不在其中的种类（如纯文本）不做校验
+var msgPayloadSchemas = map[chat.MsgType]func() interface{}{
+	chat.MsgTypeImage:   func() interface{} { return new(imagePayload) },
+	chat.MsgTypeAudio:   func() interface{} { return new(audioPayload) },
+	chat.MsgTypeVideo:   func() interface{} { return new(videoPayload) },
+	chat.MsgTypeGeo:     func() interface{} { return new(geoPayload) },
+	chat.MsgTypeFile:    func() interface{} { return new(filePayload) },
+	chat.MsgTypeContact: func() interface{} { return new(contactPayload) },
+	chat.MsgTypeSticker: func() interface{} { return new(stickerPayload) },
+}
+
+// msgSumPlaceholders 非文本消息在通知中的摘要
+var msgSumPlaceholders = map[chat.MsgType]string{
+	chat.MsgTypeImage:        "[图片]",
+	chat.MsgTypeAudio:        "[语音]",
+	chat.MsgTypeVideo:        "[视频]",
+	chat.MsgTypeGeo:          "[位置]",
+	chat.MsgTypeMergeForward: "[聊天记录]",
+	chat.MsgTypeFile:         "[文件]",
+	chat.MsgTypeContact:      "[名片]",
+	chat.MsgTypeSticker:      "[表情]",
+}
+
+// normalizeMessagePayload 按消息种类校验消息内容，返回重新序列化后的内容，不允许出现未定义的字段
+func normalizeMessagePayload(typ chat.MsgType, message string) (string, error) {
+	newPayload, ok := msgPayloadSchemas[typ]
+	if !ok {
+		return message, nil
+	}
+	payload := newPayload()
+	decoder := json.NewDecoder(bytes.NewReader([]byte(message)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload); err != nil {
+		return "", errors.New("invalid message payload: " + err.Error())
+	}
+	if errs := validator.Validate(payload); errs != nil {
+		return "", errs
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// messageSum 获得消息在通知中的摘要，文本消息为前 30 个字
+func messageSum(typ chat.MsgType, message string) string {
+	if placeholder, ok := msgSumPlaceholders[typ]; ok {
+		return placeholder
+	}
+	return util.FirstNCharOfString(message, 30)
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// pinReq 置顶与取消置顶消息的请求
+type pinReq struct {
+	ChatID    int64 `json:"chat_id" validate:"required"`
+	MessageID int64 `json:"message_id" validate:"required"`
+}
+
+// PinMessage 置顶消息 api，需要群管理或群主权限
+func PinMessage(c *fiber.Ctx) error {
+	req := new(pinReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	pin, err := chat.PinMessage(db.GetDB(), userID, req.ChatID, req.MessageID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyPinnedChanged(userID, req, true)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: pin})
+}
+
+// UnpinMessage 取消置顶消息 api，需要群管理或群主权限
+func UnpinMessage(c *fiber.Ctx) error {
+	req := new(pinReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.UnpinMessage(db.GetDB(), userID, req.ChatID, req.MessageID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyPinnedChanged(userID, req, false)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// GetPinnedMessages 获得聊天中所有置顶的消息
+func GetPinnedMessages(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	pins, err := chat.GetPinnedMessages(db.GetDB(), req.ChatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Pins []chat.PinnedMessage `json:"pins"`
+	}{
+		Pins: pins,
+	}})
+}
+
+// notifyPinnedChanged 向聊天的所有成员推送置顶消息的变化
+func notifyPinnedChanged(userID int64, req *pinReq, pinned bool) {
+	notifyOtherMembers(0, req.ChatID, false, &struct {
+		Type      int64 `json:"type"`
+		ChatID    int64 `json:"chat_id"`
+		MessageID int64 `json:"message_id"`
+		UserID    int64 `json:"user_id"`
+		Pinned    bool  `json:"pinned"`
+	}{
+		Type:      api.TypePinnedChanged,
+		ChatID:    req.ChatID,
+		MessageID: req.MessageID,
+		UserID:    userID,
+		Pinned:    pinned,
+	})
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+)
+
+// reactionReq 表情回应的请求
+type reactionReq struct {
+	ChatID    int64 `json:"chat_id" validate:"required"`
+	MessageID int64 `json:"message_id" validate:"required"`
+	// Emoji 单个 emoji
+	Emoji string `json:"emoji" validate:"required,max=31,emoji"`
+}
+
+// AddReaction 对消息添加表情回应 api
+func AddReaction(c *fiber.Ctx) error {
+	req := new(reactionReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.AddReaction(db.GetDB(), req.ChatID, userID, req.MessageID, req.Emoji); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyReactionChanged(userID, req, true)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// RemoveReaction 取消对消息的表情回应 api
+func RemoveReaction(c *fiber.Ctx) error {
+	req := new(reactionReq)
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.RemoveReaction(db.GetDB(), req.ChatID, userID, req.MessageID, req.Emoji); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	go notifyReactionChanged(userID, req, false)
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// notifyReactionChanged 向聊天的所有成员推送表情回应的变化
+func notifyReactionChanged(userID int64, req *reactionReq, added bool) {
+	notifyOtherMembers(0, req.ChatID, false, &struct {
+		Type      int64  `json:"type"`
+		ChatID    int64  `json:"chat_id"`
+		MessageID int64  `json:"message_id"`
+		UserID    int64  `json:"user_id"`
+		Emoji     string `json:"emoji"`
+		Added     bool   `json:"added"`
+	}{
+		Type:      api.TypeReactionChanged,
+		ChatID:    req.ChatID,
+		MessageID: req.MessageID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+		Added:     added,
+	})
+}
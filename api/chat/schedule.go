@@ -0,0 +1,164 @@
+package chat
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"time"
+)
+
+// schedulerInterval 后台检查定时消息与到期消息的间隔
+const schedulerInterval = time.Second
+
+// schedulerBatchSize 每次检查最多处理的消息数
+const schedulerBatchSize = 100
+
+// StartScheduler 启动后台任务，发送到期的定时消息，并删除到期的阅后即焚消息
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sendScheduledMessages()
+			sweepExpiredMessages()
+		}
+	}()
+}
+
+// sendScheduledMessages 发送到期的定时消息，并通过 websocket 通知聊天成员
+func sendScheduledMessages() {
+	logger := logger2.GetLogger()
+	msgs, err := chat.SendDueScheduledMessages(db.GetDB(), time.Now(), schedulerBatchSize)
+	if err != nil {
+		logger.WithFields(logMsgFields).Errorf("Send scheduled messages fail: %v", err)
+		return
+	}
+	for _, msg := range msgs {
+		go notifyNewMessage(msg.SenderID, msg, messageSum(msg.Type, msg.Message))
+	}
+}
+
+// sweepExpiredMessages 删除到期的阅后即焚消息，并通过 websocket 通知聊天成员
+func sweepExpiredMessages() {
+	logger := logger2.GetLogger()
+	msgs, err := chat.DeleteExpiredMessages(db.GetDB(), time.Now(), schedulerBatchSize)
+	if err != nil {
+		logger.WithFields(logMsgFields).Errorf("Delete expired messages fail: %v", err)
+		return
+	}
+	// 按聊天合并通知
+	expired := make(map[int64][]int64)
+	for _, msg := range msgs {
+		expired[msg.ChatID] = append(expired[msg.ChatID], msg.MessageID)
+	}
+	for chatID, messageIDs := range expired {
+		go notifyOtherMembers(0, chatID, false, &struct {
+			Type       int64   `json:"type"`
+			ChatID     int64   `json:"chat_id"`
+			MessageIDs []int64 `json:"message_ids"`
+		}{
+			Type:       api.TypeMessageExpired,
+			ChatID:     chatID,
+			MessageIDs: messageIDs,
+		})
+	}
+}
+
+// AddScheduledMessage 创建定时消息 api，send_at 为计划发送的 unix 时间戳，单位为秒
+func AddScheduledMessage(c *fiber.Ctx) error {
+	req := new(struct {
+		addMessageReq
+		SendAt int64 `json:"send_at" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	message, err := normalizeMessagePayload(req.Type, req.Message)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, err)})
+	}
+	req.Message = message
+
+	scheduled, err := chat.CreateScheduledMessage(db.GetDB(), req.ChatID, userID, req.Type, req.Message, chat.MsgOption{
+		ReplyToID:  req.ReplyToID,
+		BurnAfter:  req.BurnAfter,
+		MentionIDs: req.MentionIDs,
+	}, time.Unix(req.SendAt, 0))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: scheduled})
+}
+
+// CancelScheduledMessage 取消尚未发送的定时消息 api
+func CancelScheduledMessage(c *fiber.Ctx) error {
+	req := new(struct {
+		ID int64 `json:"id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	if err := chat.CancelScheduledMessage(db.GetDB(), userID, req.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
+}
+
+// GetScheduledMessages 获得自己在聊天中创建的定时消息 api
+func GetScheduledMessages(c *fiber.Ctx) error {
+	req := new(struct {
+		ChatID int64 `json:"chat_id" query:"chat_id" validate:"required"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	scheduled, err := chat.GetScheduledMessages(db.GetDB(), req.ChatID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Scheduled []chat.ScheduledMessage `json:"scheduled"`
+	}{
+		Scheduled: scheduled,
+	}})
+}
@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/ws"
+)
+
+// WSAddMessage 通过 websocket 发送消息
+func WSAddMessage(conn *ws.ConnWrapper, r *ws.Request) api.BaseRes {
+	req := new(addMessageReq)
+	if res, ok := ws.ParsePayload(r, req); !ok {
+		return res
+	}
+	message, err := normalizeMessagePayload(req.Type, req.Message)
+	if err != nil {
+		return api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, err)}
+	}
+	req.Message = message
+
+	msg, err := addMessage(conn.UserID, req)
+	if err != nil {
+		return addMessageErrorRes(err)
+	}
+
+	return api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg}
+}
+
+// WSWithdrawMessage 通过 websocket 撤回消息
+func WSWithdrawMessage(conn *ws.ConnWrapper, r *ws.Request) api.BaseRes {
+	req := new(withdrawMessageReq)
+	if res, ok := ws.ParsePayload(r, req); !ok {
+		return res
+	}
+
+	msg, err := withdrawMessage(conn.UserID, req)
+	if err != nil {
+		return api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)}
+	}
+
+	return api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: msg}
+}
+
+// WSTyping 通过 websocket 通知其他成员自己正在输入
+func WSTyping(conn *ws.ConnWrapper, r *ws.Request) api.BaseRes {
+	req := new(typingReq)
+	if res, ok := ws.ParsePayload(r, req); !ok {
+		return res
+	}
+
+	sent, err := typing(conn.UserID, req)
+	if err != nil {
+		return api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)}
+	}
+
+	return api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Sent bool `json:"sent"`
+	}{
+		Sent: sent,
+	}}
+}
+
+// WSMarkRead 通过 websocket 推进自己在聊天中的已读位置
+func WSMarkRead(conn *ws.ConnWrapper, r *ws.Request) api.BaseRes {
+	req := new(markReadReq)
+	if res, ok := ws.ParsePayload(r, req); !ok {
+		return res
+	}
+
+	lastRead, err := markRead(conn.UserID, req)
+	if err != nil {
+		return api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)}
+	}
+
+	return api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		LastReadMessageID int64 `json:"last_read_message_id"`
+	}{
+		LastReadMessageID: lastRead,
+	}}
+}
+
+// notifyOtherMembers 向聊天中除 userID 以外的成员推送事件，userID 为 0 时推送给所有成员，ephemeral 表示事件不进入收件箱
+func notifyOtherMembers(userID int64, chatID int64, ephemeral bool, v interface{}) {
+	chatMembers, err := chat.GetChatMembers(db.GetDB(), chatID)
+	if err != nil {
+		logger := logger2.GetLogger()
+		logger.WithFields(logMsgFields).Errorf("websocket to send notification fail for chat %v", chatID)
+		return
+	}
+	for _, chatMember := range chatMembers {
+		if chatMember.UserID == userID {
+			continue
+		}
+		if ephemeral {
+			_ = ws.WriteToUserEphemeral(chatMember.UserID, v)
+		} else {
+			_ = ws.WriteToUser(chatMember.UserID, v)
+		}
+	}
+}
@@ -24,6 +24,15 @@ const MsgSMSTooOften = "SMS 服务调用频率过快"
 // MsgSMSWrong SMS 验证码错误
 const MsgSMSWrong = "验证码错误"
 
+// MsgRefreshTokenInvalid refresh token 无效
+const MsgRefreshTokenInvalid = "refresh token 无效或已过期"
+
+// MsgLoginTooOften 同一 ip 登录失败次数过多
+const MsgLoginTooOften = "登录失败次数过多"
+
+// MsgUserLocked 账户被临时锁定
+const MsgUserLocked = "账户已被临时锁定"
+
 // MsgUserAlreadyExist 用户已经存在
 const MsgUserAlreadyExist = "用户已经存在"
 
@@ -39,6 +48,9 @@ const MsgChatDeleteFail = "删除聊天失败"
 // MsgChatMemberAddFail 添加群聊成员失败
 const MsgChatMemberAddFail = "添加聊天成员失败"
 
+// MsgChatMemberSilenced 被禁言
+const MsgChatMemberSilenced = "已被禁言"
+
 // MsgActivityError 动态服务异常
 const MsgActivityError = "动态服务异常"
 
@@ -78,6 +90,15 @@ const CodeUserIDNotFound = 103
 // CodeUserAlreadyExist 用户已经存在
 const CodeUserAlreadyExist = 104
 
+// CodeRefreshTokenInvalid refresh token 无效、过期或被重复使用
+const CodeRefreshTokenInvalid = 105
+
+// CodeLoginTooOften 同一 ip 登录失败次数过多
+const CodeLoginTooOften = 106
+
+// CodeUserLocked 账户因连续登录失败被临时锁定
+const CodeUserLocked = 107
+
 // CodeSMSError SMS 服务异常
 const CodeSMSError = 200
 
@@ -99,6 +120,9 @@ const CodeChatDeleteFail = 302
 // CodeChatMemberAddFail 添加群聊成员失败
 const CodeChatMemberAddFail = 303
 
+// CodeChatMemberSilenced 被禁言或群聊开启了全员禁言
+const CodeChatMemberSilenced = 304
+
 // CodeActivityError 动态服务异常
 const CodeActivityError = 400
 
@@ -118,20 +142,87 @@ const CodeActivityCommentDeleteFail = 404
  * WebSocket Type code
  */
 
+// TypePing 服务端定时发送的心跳
+const TypePing = 1
+
 // TypePong 新好友请求
 const TypePong = 2
 
+// TypeReplayDone 重连时收件箱事件补发完毕
+const TypeReplayDone = 3
+
+// TypeResponse 对客户端请求帧的回复
+const TypeResponse = 4
+
 // TypeNewFriendApply 新好友请求
 const TypeNewFriendApply = 100
 
 // TypeFriendListUpdate 好友列表更新
 const TypeFriendListUpdate = 101
 
+// TypeFriendPresence 好友上线或下线
+const TypeFriendPresence = 102
+
 // TypeAddNewMessage 新消息
 const TypeAddNewMessage = 200
 
 // TypeWithdrawMessage 撤回消息
 const TypeWithdrawMessage = 201
 
+// TypeTyping 聊天成员正在输入
+const TypeTyping = 202
+
+// TypeReadPosition 聊天成员的已读位置更新
+const TypeReadPosition = 203
+
+// TypeMessageState 私聊消息的送达状态更新
+const TypeMessageState = 204
+
+// TypeEditMessage 编辑消息
+const TypeEditMessage = 205
+
+// TypeReactionChanged 消息的表情回应变化
+const TypeReactionChanged = 206
+
+// TypePinnedChanged 群聊置顶消息变化
+const TypePinnedChanged = 207
+
+// TypeAnnouncementChanged 群公告变化
+const TypeAnnouncementChanged = 208
+
+// TypeNewJoinApply 有新的加群申请，推送给群管理及群主
+const TypeNewJoinApply = 209
+
+// TypeJoinApplyDecision 加群申请被处理，推送给申请人、邀请人及群管理
+const TypeJoinApplyDecision = 210
+
+// TypeMemberModerated 群管理执行了禁言、移出等管理操作
+const TypeMemberModerated = 211
+
+// TypeMessageExpired 阅后即焚消息到期被删除
+const TypeMessageExpired = 212
+
+// TypeMention 被提及，不受免打扰影响
+const TypeMention = 213
+
 // TypeNewActivity 好友有新动态通知
 const TypeNewActivity = 300
+
+/*
+ * WebSocket request type code，客户端发送的请求帧
+ */
+
+// ReqTypePing 客户端心跳
+const ReqTypePing = 1
+
+// ReqTypeAddMessage 发送消息
+const ReqTypeAddMessage = 200
+
+// ReqTypeWithdrawMessage 撤回消息
+const ReqTypeWithdrawMessage = 201
+
+// ReqTypeTyping 正在输入
+const ReqTypeTyping = 202
+
+// ReqTypeMarkRead 标记已读
+const ReqTypeMarkRead = 203
@@ -243,12 +243,14 @@ func GetFriends(c *fiber.Ctx) error {
 	type retType struct {
 		FriendID int64  `json:"friend_id"`
 		Alias    string `json:"alias"`
+		Online   bool   `json:"online"`
 	}
 	var ret []retType = make([]retType, 0)
 	for _, entry := range entries {
 		ret = append(ret, retType{
 			FriendID: entry.FriendID,
 			Alias:    entry.Alias,
+			Online:   ws.IsOnline(entry.FriendID),
 		})
 	}
 
@@ -322,3 +324,27 @@ func DeleteFriend(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
 }
+
+// OnPresenceChange 用户上线或下线时，通知其所有好友
+func OnPresenceChange(userID int64, online bool) {
+	logger := logger2.GetLogger()
+	entries, err := user.GetFriendEntrySelfByUserID(db.GetDB(), userID)
+	if err != nil {
+		logger.WithFields(logFields).Errorf("Could not get friends of user %v to notify presence", userID)
+		return
+	}
+	for _, entry := range entries {
+		err := ws.WriteToUserEphemeral(entry.FriendID, struct {
+			Type   int64 `json:"type"`
+			UserID int64 `json:"user_id"`
+			Online bool  `json:"online"`
+		}{
+			Type:   api.TypeFriendPresence,
+			UserID: userID,
+			Online: online,
+		})
+		if err != nil {
+			logger.WithFields(logFields).Infof("Send presence notification fail to user %v", entry.FriendID)
+		}
+	}
+}
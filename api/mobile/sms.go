@@ -1,6 +1,9 @@
 package mobile
 
 import (
+	"errors"
+	"fmt"
+	goRedis "github.com/go-redis/redis/v8"
 	"github.com/gofiber/fiber/v2"
 	"github.com/thss-cercis/cercis-server/api"
 	"github.com/thss-cercis/cercis-server/db"
@@ -33,7 +36,7 @@ func SendSMSRegister(c *fiber.Ctx) error {
 	}
 
 	return SendSMSTemplate(
-		req, redis.TagSMSSignUp, redis.ExpSMSSignUp, redis.TagSMSSignUpRetry, redis.ExpSMSSignUpRetry,
+		req, sms.PurposeSignUp, redis.TagSMSSignUp, redis.ExpSMSSignUp, redis.TagSMSSignUpRetry, redis.ExpSMSSignUpRetry,
 	)(c)
 }
 
@@ -55,25 +58,45 @@ func SendSMSRecover(c *fiber.Ctx) error {
 	}
 
 	return SendSMSTemplate(
-		req, redis.TagSMSSignUp, redis.ExpSMSSignUp, redis.TagSMSSignUpRetry, redis.ExpSMSSignUpRetry,
+		req, sms.PurposeRecover, redis.TagSMSRecover, redis.ExpSMSRecover, redis.TagSMSRecoverRetry, redis.ExpSMSRecoverRetry,
 	)(c)
 }
 
-func SendSMSTemplate(req *SMSReq, tag string, exp time.Duration, tagRetry string, expRetry time.Duration) func(ctx *fiber.Ctx) error {
+// SendSMSLogin 发送登录验证码，只能发送给已经注册的手机号
+func SendSMSLogin(c *fiber.Ctx) error {
+	req := &SMSReq{}
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	if _, err := user.GetUserByMobile(db.GetDB(), req.Mobile); err != nil {
+		// 用户不存在
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeUserIDNotFound, Msg: util.MsgWithError(api.MsgUserNotFound, err)})
+	}
+
+	return SendSMSTemplate(
+		req, sms.PurposeLogin, redis.TagSMSLogin, redis.ExpSMSLogin, redis.TagSMSLoginRetry, redis.ExpSMSLoginRetry,
+	)(c)
+}
+
+func SendSMSTemplate(req *SMSReq, purpose sms.Purpose, tag string, exp time.Duration, tagRetry string, expRetry time.Duration) func(ctx *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		// 冷却期仍未过
 		if _, err := redis.GetKV(tagRetry, req.Mobile); err == nil {
 			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSTooOften, Msg: api.MsgSMSTooOften})
 		}
 
-		client, ok := sms.GetClient()
-		if !ok {
-			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSError, Msg: api.MsgSMSError})
+		code, err := sms.NewRandomCode()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
 		}
-
-		code := sms.NewRandomCode()
-		res, err := sms.SendSMS(client, req.Mobile, code)
-		if err != nil || res.Code != "OK" {
+		err = sms.SendCode(req.Mobile, purpose, code)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSError, Msg: util.MsgWithError(api.MsgSMSError, err)})
 		}
 
@@ -81,6 +104,11 @@ func SendSMSTemplate(req *SMSReq, tag string, exp time.Duration, tagRetry string
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
 		}
+		// 新的验证码重新计算错误次数
+		err = redis.DelKV(redis.TagSMSAttempt, attemptKey(tag, req.Mobile))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+		}
 		// 1 分钟内禁止再索要短信
 		err = redis.PutKV(tagRetry, req.Mobile, code, expRetry)
 		if err != nil {
@@ -90,3 +118,48 @@ func SendSMSTemplate(req *SMSReq, tag string, exp time.Duration, tagRetry string
 		return c.JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
 	}
 }
+
+// maxSMSAttempts 同一个验证码允许的错误次数，达到后验证码失效
+const maxSMSAttempts = 5
+
+// ErrSMSCodeWrong 验证码错误、已过期或已失效
+var ErrSMSCodeWrong = errors.New("sms code is wrong or expired")
+
+func attemptKey(tag string, mobile string) string {
+	return fmt.Sprintf("%v_%v", tag, mobile)
+}
+
+// VerifySMSCode 校验某项服务的验证码. 校验成功后验证码立即失效，错误次数达到 maxSMSAttempts 后验证码同样失效.
+//
+// Throws: ErrSMSCodeWrong
+func VerifySMSCode(tag string, mobile string, code string) error {
+	stored, err := redis.GetKV(tag, mobile)
+	if err == goRedis.Nil {
+		return ErrSMSCodeWrong
+	} else if err != nil {
+		return err
+	}
+	if stored != code {
+		exp, err := redis.GetKVExp(tag, mobile)
+		if err != nil {
+			return err
+		}
+		attempts, err := redis.IncrKV(redis.TagSMSAttempt, attemptKey(tag, mobile), exp)
+		if err != nil {
+			return err
+		}
+		if attempts >= maxSMSAttempts {
+			if err := redis.DelKV(tag, mobile); err != nil {
+				return err
+			}
+		}
+		return ErrSMSCodeWrong
+	}
+	// 只允许使用一次，并发使用时只有一个请求能取到
+	if _, err := redis.PopKV(tag, mobile); err == goRedis.Nil {
+		return ErrSMSCodeWrong
+	} else if err != nil {
+		return err
+	}
+	return redis.DelKV(redis.TagSMSAttempt, attemptKey(tag, mobile))
+}
@@ -3,8 +3,13 @@ package search
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/config"
 	"github.com/thss-cercis/cercis-server/db"
+	"github.com/thss-cercis/cercis-server/db/chat"
 	"github.com/thss-cercis/cercis-server/db/user"
+	"github.com/thss-cercis/cercis-server/middleware"
+	"github.com/thss-cercis/cercis-server/util"
+	"time"
 )
 
 func SearchUser(c *fiber.Ctx) error {
@@ -78,3 +83,75 @@ func SearchUser(c *fiber.Ctx) error {
 		Users: users,
 	}})
 }
+
+// searchMessagesDefaultLimit 未指定 limit 时单次搜索消息返回的条数
+const searchMessagesDefaultLimit = 20
+
+// SearchMessages 在自己所在的聊天中全文搜索消息
+func SearchMessages(c *fiber.Ctx) error {
+	req := new(struct {
+		Query    string `json:"q" query:"q" validate:"required,max=100"`
+		ChatID   int64  `json:"chat_id" query:"chat_id"`
+		SenderID int64  `json:"sender_id" query:"sender_id"`
+		Type     *int64 `json:"type" query:"type"`
+		// From 与 To 为 unix 时间戳，单位为秒
+		From   int64 `json:"from" query:"from"`
+		To     int64 `json:"to" query:"to"`
+		Cursor int64 `json:"cursor" query:"cursor"`
+		Limit  int   `json:"limit" query:"limit" validate:"gte=0,lte=100"`
+	})
+
+	if ok, err := api.ParamParserWrap(c, req); !ok {
+		return err
+	}
+
+	if ok, err := api.ValidateWrap(c, req); !ok {
+		return err
+	}
+
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	opt := &chat.SearchOption{
+		ChatID:   req.ChatID,
+		SenderID: req.SenderID,
+		Cursor:   req.Cursor,
+		Limit:    req.Limit,
+	}
+	if opt.Limit == 0 {
+		opt.Limit = searchMessagesDefaultLimit
+	}
+	if req.Type != nil {
+		msgType := chat.MsgType(*req.Type)
+		opt.Type = &msgType
+	}
+	if req.From != 0 {
+		from := time.Unix(req.From, 0)
+		opt.From = &from
+	}
+	if req.To != 0 {
+		to := time.Unix(req.To, 0)
+		opt.To = &to
+	}
+
+	results, err := chat.SearchMessages(db.GetDB(), userID, config.GetConfig().Chat.SearchConfig, req.Query, opt)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeChatError, Msg: util.MsgWithError(api.MsgChatError, err)})
+	}
+
+	// 返回条数不足时说明没有更多结果
+	var nextCursor int64
+	if len(results) == opt.Limit {
+		nextCursor = results[len(results)-1].ID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Messages   []chat.SearchResult `json:"messages"`
+		NextCursor int64               `json:"next_cursor"`
+	}{
+		Messages:   results,
+		NextCursor: nextCursor,
+	}})
+}
@@ -3,12 +3,14 @@ package user
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/thss-cercis/cercis-server/api"
+	"github.com/thss-cercis/cercis-server/api/mobile"
 	"github.com/thss-cercis/cercis-server/db"
 	userDB "github.com/thss-cercis/cercis-server/db/user"
 	"github.com/thss-cercis/cercis-server/middleware"
 	"github.com/thss-cercis/cercis-server/redis"
 	"github.com/thss-cercis/cercis-server/util"
 	"github.com/thss-cercis/cercis-server/util/security"
+	"strconv"
 )
 
 // CurrentUser 查询当前用户信息的 api
@@ -178,6 +180,12 @@ func ModifyPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
 	}
 
+	// 吊销其他设备的登录
+	sessionID, _ := middleware.GetSessionIDFromSession(c)
+	if err := middleware.RevokeOtherDevices(userID, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
 }
 
@@ -198,8 +206,7 @@ func RecoverPassword(c *fiber.Ctx) error {
 	}
 
 	// 检验 code
-	code, err := redis.GetKV(redis.TagSMSRecover, req.Mobile)
-	if err != nil || code != req.Code {
+	if err := mobile.VerifySMSCode(redis.TagSMSRecover, req.Mobile, req.Code); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeSMSWrong, Msg: util.MsgWithError(api.MsgSMSWrong, err)})
 	}
 
@@ -215,6 +222,37 @@ func RecoverPassword(c *fiber.Ctx) error {
 
 	// 更改密码
 	user.Password = newPwd
+	err = user.UpdateTo(db.GetDB())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	// 吊销全部设备的登录
+	if err := middleware.RevokeOtherDevices(user.ID, ""); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+	// 通过短信验证后解除登录锁定
+	_ = redis.DelKV(redis.TagLoginLock, strconv.FormatInt(user.ID, 10))
+	_ = redis.DelKV(redis.TagLoginFailAccount, strconv.FormatInt(user.ID, 10))
 
 	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess})
 }
+
+// GetAuditEvents 获得当前用户最近的账户安全审计事件，如账户锁定与可疑登录
+func GetAuditEvents(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromSession(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	}
+
+	events, err := userDB.GetAuditEvents(db.GetDB(), userID, 50)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeFailure, Msg: util.MsgWithError(api.MsgUnknown, err)})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Events []userDB.AuditEvent `json:"events"`
+	}{
+		Events: events,
+	}})
+}
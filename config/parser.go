@@ -14,6 +14,14 @@ type Config struct {
 		Logger struct {
 			Level uint32
 		}
+		// ProxyHeader 部署在反向代理之后时，携带客户端 ip 的请求头，如 X-Forwarded-For
+		ProxyHeader string
+		// TrustedProxies 可信的反向代理 ip 或 CIDR，只有来自这些地址的请求才使用 ProxyHeader
+		TrustedProxies []string
+	}
+	Websocket struct {
+		// Backend 推送的投递后端，local 或 redis
+		Backend string
 	}
 	Redis struct {
 		Host     string
@@ -32,12 +40,34 @@ type Config struct {
 		Sslmode  string
 		Timezone string
 	}
+	Auth struct {
+		// Secret 签发 access token 使用的密钥，多实例部署时需要一致
+		Secret string
+	}
 	SMS struct {
+		// Provider 短信服务提供者，aliyun、log 或 memory
+		Provider     string
 		Region       string
 		AccessKey    string
 		Secret       string
 		SignName     string
 		TemplateCode string
+		// Templates 各个用途的模板编号，为空时使用 TemplateCode
+		Templates struct {
+			SignUp  string
+			Recover string
+			Login   string
+		}
+	}
+	Chat struct {
+		// EditWindow 消息发出后允许编辑的时限，单位为秒，0 表示不限制
+		EditWindow int64
+		// SearchConfig 消息全文检索使用的 postgres 配置名，为空时使用 simple
+		SearchConfig string
+	}
+	Export struct {
+		// Dir 聊天记录导出文件的存放目录，多实例部署时需要共享
+		Dir string
 	}
 	Qiniu struct {
 		AccessKey string
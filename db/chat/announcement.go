@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ChatAnnouncement 群公告的修改历史，每次修改记录一条
+type ChatAnnouncement struct {
+	ID     int64 `gorm:"primaryKey" json:"id"`
+	ChatID int64 `gorm:"index" json:"chat_id"`
+	// EditorID 修改公告的管理员
+	EditorID int64  `gorm:"type:bigint not null" json:"editor_id"`
+	Content  string `gorm:"type:text not null" json:"content"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetAnnouncement 修改群公告并记录历史，execID 为执行者，需要为群管理或群主
+func SetAnnouncement(db *gorm.DB, execID int64, chatID int64, content string) (*ChatAnnouncement, error) {
+	announcement := &ChatAnnouncement{
+		ChatID:   chatID,
+		EditorID: execID,
+		Content:  content,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := CheckGroupPermission(tx, chatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		if err := tx.Model(&Chat{}).Where("id = ?", chatID).Update("announcement", content).Error; err != nil {
+			return err
+		}
+		return tx.Create(announcement).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+// GetAnnouncementHistory 获得群公告的修改历史，最新的在前
+func GetAnnouncementHistory(db *gorm.DB, chatID int64, userID int64) ([]ChatAnnouncement, error) {
+	if !CheckIfInChat(db, chatID, userID) {
+		return nil, errors.New("user is not in the chat")
+	}
+	ret := make([]ChatAnnouncement, 0)
+	return ret, db.Where("chat_id = ?", chatID).Order("id DESC").Find(&ret).Error
+}
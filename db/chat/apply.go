@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/soft_delete"
+	"time"
+)
+
+type JoinApplyState int64
+
+const (
+	JoinStateReject    JoinApplyState = -1
+	JoinStateUncertain JoinApplyState = 0
+	JoinStateAccept    JoinApplyState = 1
+)
+
+// ChatJoinApply 加入群聊的申请，需要群管理或群主审核
+type ChatJoinApply struct {
+	ID     int64 `gorm:"primarykey" json:"id"`
+	ChatID int64 `gorm:"type:bigint not null;index" json:"chat_id"`
+	// UserID 申请加入的用户
+	UserID int64 `gorm:"type:bigint not null;index" json:"user_id"`
+	// InviterID 邀请人，通过邀请链接申请时为 0
+	InviterID int64 `gorm:"type:bigint not null;default:0" json:"inviter_id"`
+	// InviteID 使用的邀请链接，由成员直接邀请时为 0
+	InviteID int64          `gorm:"type:bigint not null;default:0" json:"invite_id"`
+	Remark   string         `gorm:"type:varChar(255) not null" json:"remark"`
+	State    JoinApplyState `gorm:"type:smallint not null;check:state >= -1 and state <= 1" json:"state"`
+	// ReviewerID 处理申请的管理员，未处理时为 0
+	ReviewerID int64 `gorm:"type:bigint not null;default:0" json:"reviewer_id"`
+
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	DeletedAt soft_delete.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// GetChatJoinApplyByID 根据 id 获取加群申请
+func GetChatJoinApplyByID(db *gorm.DB, applyID int64) (*ChatJoinApply, error) {
+	apply := new(ChatJoinApply)
+	err := db.First(apply, applyID).Error
+	return apply, err
+}
+
+// GetUncertainChatJoinApply 获取一个待确定的加群申请
+func GetUncertainChatJoinApply(db *gorm.DB, chatID int64, userID int64) (*ChatJoinApply, error) {
+	apply := new(ChatJoinApply)
+	err := db.First(apply, "chat_id = ? AND user_id = ? AND state = ?", chatID, userID, JoinStateUncertain).Error
+	return apply, err
+}
+
+// CreateChatJoinApply 创建一个新的待确定的加群申请
+func CreateChatJoinApply(db *gorm.DB, chatID int64, userID int64, inviterID int64, inviteID int64, remark string) (*ChatJoinApply, error) {
+	apply := &ChatJoinApply{
+		ChatID:    chatID,
+		UserID:    userID,
+		InviterID: inviterID,
+		InviteID:  inviteID,
+		Remark:    remark,
+		State:     JoinStateUncertain,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if CheckIfInChat(tx, chatID, userID) {
+			return errors.New("user is already in the chat")
+		}
+		if CheckIfBanned(tx, chatID, userID) {
+			return errors.New("user is banned from the chat")
+		}
+		if _, err := GetUncertainChatJoinApply(tx, chatID, userID); err == nil {
+			return errors.New("已经存在待确认的申请")
+		}
+		return tx.Create(apply).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apply, nil
+}
+
+// GetChatJoinAppliesByUserID 获得用户自己的加群申请列表
+func GetChatJoinAppliesByUserID(db *gorm.DB, userID int64) ([]ChatJoinApply, error) {
+	ret := make([]ChatJoinApply, 0)
+	return ret, db.Where("user_id = ?", userID).Order("id DESC").Find(&ret).Error
+}
+
+// InviteChatMember 成员 execID 邀请 userID 加入群聊.
+// 群聊开启了加群审核且邀请人不是群管理或群主时，返回待确定的加群申请，否则直接加入并返回成员表项.
+func InviteChatMember(db *gorm.DB, execID int64, chatID int64, userID int64) (*ChatUser, *ChatJoinApply, error) {
+	var chatUser *ChatUser
+	var apply *ChatJoinApply
+	err := db.Transaction(func(tx *gorm.DB) error {
+		chat, err := GetChat(tx, chatID)
+		if err != nil {
+			return err
+		}
+		// 只有群成员能邀请
+		if err := CheckGroupPermission(tx, chatID, execID, PermNormal); err != nil {
+			return err
+		}
+		if chat.JoinApproval && CheckGroupPermission(tx, chatID, execID, PermAdmin) != nil {
+			apply, err = CreateChatJoinApply(tx, chatID, userID, execID, 0, "")
+		} else {
+			chatUser, err = AddChatMember(tx, chatID, userID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return chatUser, apply, nil
+}
+
+// GetUncertainChatJoinApplies 获得群聊中待审核的加群申请，execID 为执行者，需要为群管理或群主
+func GetUncertainChatJoinApplies(db *gorm.DB, execID int64, chatID int64) ([]ChatJoinApply, error) {
+	if err := CheckGroupPermission(db, chatID, execID, PermAdmin); err != nil {
+		return nil, err
+	}
+	ret := make([]ChatJoinApply, 0)
+	return ret, db.Where("chat_id = ? AND state = ?", chatID, JoinStateUncertain).Order("id").Find(&ret).Error
+}
+
+// reviewChatJoinApply 审核一个待确定的加群申请，execID 为执行者，需要为群管理或群主
+func reviewChatJoinApply(db *gorm.DB, execID int64, applyID int64, state JoinApplyState) (*ChatJoinApply, error) {
+	var apply *ChatJoinApply
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		apply, err = GetChatJoinApplyByID(tx, applyID)
+		if err != nil || apply.State != JoinStateUncertain {
+			return errors.Errorf("Error: %v, %v", err, "获取待确定的加群申请失败")
+		}
+		if err := CheckGroupPermission(tx, apply.ChatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		if state == JoinStateAccept {
+			// 通过邀请链接的申请，需要邀请在审核时仍然可用
+			if apply.InviteID != 0 {
+				if err := useChatInvite(tx, apply.InviteID); err != nil {
+					return errors.Wrap(err, "邀请链接已不可用")
+				}
+			}
+			if _, err := AddChatMember(tx, apply.ChatID, apply.UserID); err != nil {
+				return errors.Wrap(err, "加入群聊失败")
+			}
+		}
+		apply.State = state
+		apply.ReviewerID = execID
+		if err := tx.Save(apply).Error; err != nil {
+			return errors.Wrap(err, "更新加群申请状态失败")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apply, nil
+}
+
+// AcceptChatJoinApply 通过一个待确定的加群申请，并将申请人加入群聊
+func AcceptChatJoinApply(db *gorm.DB, execID int64, applyID int64) (*ChatJoinApply, error) {
+	return reviewChatJoinApply(db, execID, applyID, JoinStateAccept)
+}
+
+// RejectChatJoinApply 拒绝一个待确定的加群申请
+func RejectChatJoinApply(db *gorm.DB, execID int64, applyID int64) (*ChatJoinApply, error) {
+	return reviewChatJoinApply(db, execID, applyID, JoinStateReject)
+}
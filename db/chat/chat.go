@@ -35,6 +35,12 @@ type Chat struct {
 	Type   ChatType `gorm:"type:smallint not null;check:type >= 0 and type <= 1" json:"type"`
 	Name   string   `gorm:"type:varChar(127) not null" json:"name"`
 	Avatar string   `gorm:"type:varChar(255) not null" json:"avatar"`
+	// Announcement 群公告，修改历史见 ChatAnnouncement
+	Announcement string `gorm:"type:text not null;default:''" json:"announcement"`
+	// MuteAll 全员禁言，开启后只有群管理及群主可以发言
+	MuteAll bool `gorm:"not null;default:false" json:"mute_all"`
+	// JoinApproval 开启后，非管理员成员的直接邀请会变为待审核的加群申请
+	JoinApproval bool `gorm:"not null;default:false" json:"join_approval"`
 
 	Members  []user.User `gorm:"many2many:chat_users;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
 	Messages []Message   `gorm:"foreignKey:ChatID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
@@ -52,12 +58,43 @@ type ChatUser struct {
 	Alias string `gorm:"type:varChar(127) not null" json:"alias"`
 	// 群内权限
 	Permission MemberPermission `gorm:"type:smallint not null;check:permission >= 0;default:0;" json:"permission"`
+	// LastReadMessageID 已读到的消息 id，为 0 表示未读任何消息
+	LastReadMessageID int64 `gorm:"type:bigint not null;default:0" json:"last_read_message_id"`
+	// MuteUntil 免打扰的截止时间，为 null 表示未开启免打扰
+	MuteUntil *time.Time `json:"mute_until"`
+	// Archived 是否已归档此聊天
+	Archived bool `gorm:"not null;default:false" json:"archived"`
+	// TopAt 置顶此聊天的时间，为 null 表示未置顶
+	TopAt *time.Time `json:"top_at"`
+	// SilencedUntil 被管理员禁言的截止时间，为 null 表示未被禁言
+	SilencedUntil *time.Time `json:"silenced_until"`
+	// BannedUntil 被移出群聊后禁止重新加入的截止时间，只在已删除的成员表项上设置
+	BannedUntil *time.Time `json:"-"`
 
 	CreatedAt time.Time             `json:"created_at"`
 	UpdatedAt time.Time             `json:"-"`
 	DeletedAt soft_delete.DeletedAt `gorm:"uniqueIndex:idx_chat_user_delete" json:"deleted_at"`
 }
 
+// MemberSettings 成员对聊天的个人设置，为 nil 的字段不修改
+type MemberSettings struct {
+	// MuteUntil 免打扰的截止时间，零值表示取消免打扰
+	MuteUntil *time.Time
+	Archived  *bool
+	// Top 为 true 时置顶到最前，为 false 时取消置顶
+	Top *bool
+}
+
+// IsMuted 判断成员在 now 时是否处于免打扰中
+func (chatUser *ChatUser) IsMuted(now time.Time) bool {
+	return chatUser.MuteUntil != nil && chatUser.MuteUntil.After(now)
+}
+
+// IsSilenced 判断成员在 now 时是否处于禁言中
+func (chatUser *ChatUser) IsSilenced(now time.Time) bool {
+	return chatUser.SilencedUntil != nil && chatUser.SilencedUntil.After(now)
+}
+
 // CreatePrivateChat 创建私人聊天，若已经存在私聊，则返回此私聊
 func CreatePrivateChat(db *gorm.DB, user1 int64, user2 int64) (*Chat, error) {
 	tx := db.Begin()
@@ -212,25 +249,34 @@ func DeleteChat(db *gorm.DB, execID int64, chatID int64) error {
 
 // AddChatMember 通过用户 UserID 和聊天 UserID 加入新成员
 func AddChatMember(db *gorm.DB, chatID int64, userID int64) (*ChatUser, error) {
-	tx := db.Begin()
-	chat, err := GetChat(tx, chatID)
-	if err != nil {
-		tx.Rollback()
-		return nil, err
-	}
-	if chat.Type == ChatTypePrivate {
-		return nil, errors.New("could not add member to private chat")
-	}
 	chatUser := &ChatUser{
 		ChatID:     chatID,
 		UserID:     userID,
 		Permission: PermNormal,
 	}
-	err = tx.Create(chatUser).Error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		chat, err := GetChat(tx, chatID)
+		if err != nil {
+			return err
+		}
+		if chat.Type == ChatTypePrivate {
+			return errors.New("could not add member to private chat")
+		}
+		if CheckIfInChat(tx, chatID, userID) {
+			return errors.New("user is already in the chat")
+		}
+		if CheckIfBanned(tx, chatID, userID) {
+			return errors.New("user is banned from the chat")
+		}
+		if chatUser.SilencedUntil, err = getSilencedUntil(tx, chatID, userID); err != nil {
+			return err
+		}
+		return tx.Create(chatUser).Error
+	})
 	if err != nil {
 		return nil, err
 	}
-	return chatUser, tx.Commit().Error
+	return chatUser, nil
 }
 
 // GetChatMember 获得某个群成员表项
@@ -239,6 +285,76 @@ func GetChatMember(db *gorm.DB, chatID int64, userID int64) (*ChatUser, error) {
 	return chatUser, db.Where("chat_id = ? AND user_id = ?", chatID, userID).First(chatUser).Error
 }
 
+// GetAllMemberships 获得一个人在所有聊天中的成员表项
+func GetAllMemberships(db *gorm.DB, userID int64) ([]ChatUser, error) {
+	ret := make([]ChatUser, 0)
+	return ret, db.Find(&ret, "user_id = ?", userID).Error
+}
+
+// ModifyMemberSettings 修改 userID 对聊天的个人设置，返回修改后的成员表项
+func ModifyMemberSettings(db *gorm.DB, chatID int64, userID int64, settings *MemberSettings) (*ChatUser, error) {
+	var chatUser *ChatUser
+	err := db.Transaction(func(tx *gorm.DB) error {
+		member, err := GetChatMember(tx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		updates := make(map[string]interface{})
+		if settings.MuteUntil != nil {
+			if settings.MuteUntil.IsZero() {
+				updates["mute_until"] = nil
+			} else {
+				updates["mute_until"] = *settings.MuteUntil
+			}
+		}
+		if settings.Archived != nil {
+			updates["archived"] = *settings.Archived
+		}
+		if settings.Top != nil {
+			if *settings.Top {
+				updates["top_at"] = time.Now()
+			} else {
+				updates["top_at"] = nil
+			}
+		}
+		if len(updates) != 0 {
+			if err := tx.Model(member).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		chatUser, err = GetChatMember(tx, chatID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chatUser, nil
+}
+
+// CheckGroupPermission 检查 userID 是否为群聊 chatID 中权限不低于 perm 的成员
+func CheckGroupPermission(db *gorm.DB, chatID int64, userID int64, perm MemberPermission) error {
+	chat, err := GetChat(db, chatID)
+	if err != nil {
+		return err
+	} else if chat.Type != ChatTypeGroup {
+		return errors.New("the chat is not a group chat")
+	}
+	member, err := GetChatMember(db, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Permission < perm {
+		return errors.New("you have no permission to do this")
+	}
+	return nil
+}
+
+// GetChatAdmins 获得一个群中所有群管理及群主的成员表项
+func GetChatAdmins(db *gorm.DB, chatID int64) ([]ChatUser, error) {
+	ret := make([]ChatUser, 0)
+	return ret, db.Find(&ret, "chat_id = ? AND permission >= ?", chatID, PermAdmin).Error
+}
+
 // GetChatMembers 获得一个群的所有成员表项
 func GetChatMembers(db *gorm.DB, chatID int64) ([]ChatUser, error) {
 	ret := make([]ChatUser, 0)
@@ -342,6 +458,11 @@ func DeleteChatMember(db *gorm.DB, execID int64, chatID int64, userID int64) err
 		if delUser.Permission >= execUser.Permission && execID != userID {
 			return errors.New("you have no permission to do this")
 		}
+		if execID != userID {
+			if err := addModerationLog(tx, chatID, execID, userID, ActionKick, nil); err != nil {
+				return err
+			}
+		}
 		return tx.Delete(&ChatUser{}, "chat_id = ? AND user_id = ?", chatID, userID).Error
 	})
 }
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type DeliveryState int64
+
+const (
+	// DeliveryStateSent 已发送，接收者的设备尚未收到
+	DeliveryStateSent = 0
+	// DeliveryStateDelivered 已送达接收者的设备
+	DeliveryStateDelivered = 1
+	// DeliveryStateRead 接收者已读
+	DeliveryStateRead = 2
+)
+
+// MessageDelivery 消息首次送达某个接收者设备的记录
+type MessageDelivery struct {
+	ChatID      int64     `gorm:"primaryKey" json:"chat_id"`
+	MessageID   int64     `gorm:"primaryKey" json:"message_id"`
+	UserID      int64     `gorm:"primaryKey" json:"user_id"`
+	DeliveredAt time.Time `gorm:"not null" json:"delivered_at"`
+}
+
+// RecipientDelivery 一条消息对某个接收者的送达状态
+type RecipientDelivery struct {
+	UserID      int64         `json:"user_id"`
+	State       DeliveryState `json:"state"`
+	DeliveredAt *time.Time    `json:"delivered_at"`
+}
+
+// MarkDelivered 记录消息已经送达 userID 的设备，只保留首次送达的时间，first 表示是否为首次送达
+func MarkDelivered(db *gorm.DB, chatID int64, messageID int64, userID int64) (first bool, err error) {
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&MessageDelivery{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		UserID:      userID,
+		DeliveredAt: time.Now(),
+	})
+	return res.RowsAffected == 1, res.Error
+}
+
+// GetMessageDelivery 获得一条消息对除发送者以外每个成员的送达状态，以及所有接收者中最落后的状态
+func GetMessageDelivery(db *gorm.DB, msg *Message) (DeliveryState, []RecipientDelivery, error) {
+	members, err := GetChatMembers(db, msg.ChatID)
+	if err != nil {
+		return DeliveryStateSent, nil, err
+	}
+	deliveries := make([]MessageDelivery, 0)
+	if err := db.Find(&deliveries, "chat_id = ? AND message_id = ?", msg.ChatID, msg.MessageID).Error; err != nil {
+		return DeliveryStateSent, nil, err
+	}
+	deliveredAt := make(map[int64]time.Time)
+	for _, delivery := range deliveries {
+		deliveredAt[delivery.UserID] = delivery.DeliveredAt
+	}
+
+	var state DeliveryState = DeliveryStateRead
+	ret := make([]RecipientDelivery, 0)
+	for _, member := range members {
+		if member.UserID == msg.SenderID {
+			continue
+		}
+		recipient := RecipientDelivery{UserID: member.UserID, State: DeliveryStateSent}
+		if t, ok := deliveredAt[member.UserID]; ok {
+			recipient.State = DeliveryStateDelivered
+			recipient.DeliveredAt = &t
+		}
+		if member.LastReadMessageID >= msg.MessageID {
+			recipient.State = DeliveryStateRead
+		}
+		if recipient.State < state {
+			state = recipient.State
+		}
+		ret = append(ret, recipient)
+	}
+	return state, ret, nil
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ExportState int64
+
+const (
+	// ExportStatePending 等待导出
+	ExportStatePending ExportState = 0
+	// ExportStateRunning 正在导出
+	ExportStateRunning ExportState = 1
+	// ExportStateDone 导出完成，可以下载
+	ExportStateDone ExportState = 2
+	// ExportStateFailed 导出失败
+	ExportStateFailed ExportState = 3
+)
+
+// ExportJob 聊天记录的异步导出任务
+type ExportJob struct {
+	ID     int64       `gorm:"primaryKey" json:"id"`
+	ChatID int64       `gorm:"type:bigint not null" json:"chat_id"`
+	UserID int64       `gorm:"type:bigint not null;index" json:"user_id"`
+	State  ExportState `gorm:"type:smallint not null;default:0;index" json:"state"`
+	// MessageCount 导出的消息数
+	MessageCount int64 `gorm:"type:bigint not null;default:0" json:"message_count"`
+	// Error 导出失败的原因
+	Error      string     `gorm:"type:varChar(255) not null;default:''" json:"error"`
+	FinishedAt *time.Time `json:"finished_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MembershipInterval 用户在聊天中的一段成员时间，Until 为 nil 表示至今仍是成员
+type MembershipInterval struct {
+	Since time.Time
+	Until *time.Time
+}
+
+// Contains 判断某个时间是否在成员时间内
+func (interval *MembershipInterval) Contains(t time.Time) bool {
+	return !t.Before(interval.Since) && (interval.Until == nil || t.Before(*interval.Until))
+}
+
+// CreateExportJob 为 userID 创建聊天的导出任务，同一聊天同时只能有一个未完成的任务
+func CreateExportJob(db *gorm.DB, userID int64, chatID int64) (*ExportJob, error) {
+	job := &ExportJob{
+		ChatID: chatID,
+		UserID: userID,
+		State:  ExportStatePending,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !CheckIfInChat(tx, chatID, userID) {
+			return errors.New("user is not in the chat")
+		}
+		var count int64
+		if err := tx.Model(&ExportJob{}).
+			Where("chat_id = ? AND user_id = ? AND state IN ?", chatID, userID, []ExportState{ExportStatePending, ExportStateRunning}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 0 {
+			return errors.New("an export job of the chat is already in progress")
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetExportJob 获得 userID 自己的导出任务
+func GetExportJob(db *gorm.DB, userID int64, jobID int64) (*ExportJob, error) {
+	job := &ExportJob{}
+	return job, db.Where("id = ? AND user_id = ?", jobID, userID).First(job).Error
+}
+
+// ClaimExportJob 领取一个等待中的导出任务并标记为正在导出，没有任务时返回 nil.
+// updated_at 早于 staleBefore 的正在导出的任务视为所在实例已经崩溃，同样可以被重新领取.
+// 使用 SKIP LOCKED，多个实例同时运行时不会重复领取.
+func ClaimExportJob(db *gorm.DB, staleBefore time.Time) (*ExportJob, error) {
+	jobs := make([]ExportJob, 0)
+	err := db.Raw("UPDATE export_jobs SET state = ?, updated_at = ? WHERE id = "+
+		"(SELECT id FROM export_jobs WHERE state = ? OR (state = ? AND updated_at < ?) "+
+		"ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING *",
+		ExportStateRunning, time.Now(), ExportStatePending, ExportStateRunning, staleBefore).
+		Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// TouchExportJob 更新正在导出的任务的 updated_at，表示任务仍在进行
+func TouchExportJob(db *gorm.DB, jobID int64) error {
+	return db.Model(&ExportJob{}).Where("id = ? AND state = ?", jobID, ExportStateRunning).Update("updated_at", time.Now()).Error
+}
+
+// DeleteFinishedExportJobs 删除 finished_at 早于 before 的已结束的导出任务，返回被删除的任务 id
+func DeleteFinishedExportJobs(db *gorm.DB, before time.Time) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := db.Raw("DELETE FROM export_jobs WHERE id IN "+
+		"(SELECT id FROM export_jobs WHERE state IN ? AND finished_at < ? FOR UPDATE SKIP LOCKED) RETURNING id",
+		[]ExportState{ExportStateDone, ExportStateFailed}, before).
+		Scan(&ids).Error
+	return ids, err
+}
+
+// FinishExportJob 记录导出任务的结果，err 不为 nil 时标记为失败
+func FinishExportJob(db *gorm.DB, job *ExportJob, messageCount int64, err error) error {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.MessageCount = messageCount
+	if err != nil {
+		job.State = ExportStateFailed
+		job.Error = err.Error()
+	} else {
+		job.State = ExportStateDone
+	}
+	return db.Save(job).Error
+}
+
+// GetMembershipIntervals 获得用户在聊天中所有的成员时间，包括已经退出的
+func GetMembershipIntervals(db *gorm.DB, chatID int64, userID int64) ([]MembershipInterval, error) {
+	memberships := make([]ChatUser, 0)
+	if err := db.Unscoped().Where("chat_id = ? AND user_id = ?", chatID, userID).Order("created_at").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	ret := make([]MembershipInterval, 0, len(memberships))
+	for _, membership := range memberships {
+		interval := MembershipInterval{Since: membership.CreatedAt}
+		if membership.DeletedAt != 0 {
+			until := time.Unix(int64(membership.DeletedAt), 0)
+			interval.Until = &until
+		}
+		ret = append(ret, interval)
+	}
+	return ret, nil
+}
@@ -0,0 +1,199 @@
+package chat
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// MergedForwardItem 合并转发消息中的一条聊天记录，保存转发时的快照
+type MergedForwardItem struct {
+	ID int64 `gorm:"primaryKey" json:"-"`
+	// ChatID 与 MessageID 为所属的合并转发消息
+	ChatID    int64 `gorm:"index:idx_chat_message_merged" json:"chat_id"`
+	MessageID int64 `gorm:"index:idx_chat_message_merged" json:"message_id"`
+	// Seq 在合并转发消息中的顺序
+	Seq int64 `gorm:"type:bigint not null" json:"seq"`
+
+	OriginChatID    int64     `gorm:"type:bigint not null" json:"origin_chat_id"`
+	OriginMessageID int64     `gorm:"type:bigint not null" json:"origin_message_id"`
+	SenderID        int64     `gorm:"type:bigint not null" json:"sender_id"`
+	Type            MsgType   `gorm:"type:smallint not null" json:"type"`
+	Message         string    `gorm:"type:text not null" json:"message"`
+	OriginCreatedAt time.Time `json:"origin_created_at"`
+}
+
+// MergedForwardContent 合并转发消息的 Message 字段内容
+type MergedForwardContent struct {
+	Title string `json:"title"`
+	Count int    `json:"count"`
+}
+
+// uniqueChatIDs 合并源聊天与目标聊天并去重，CheckIfUserInChats 要求聊天 id 不重复
+func uniqueChatIDs(chatID int64, targetChatIDs []int64) []int64 {
+	seen := map[int64]bool{chatID: true}
+	ret := []int64{chatID}
+	for _, id := range targetChatIDs {
+		if !seen[id] {
+			seen[id] = true
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+// getForwardableMessages 获得可以转发的源消息，按 message_id 排序，已撤回或阅后即焚的消息不能转发
+func getForwardableMessages(db *gorm.DB, chatID int64, messageIDs []int64) ([]Message, error) {
+	msgs := make([]Message, 0)
+	if err := db.Where("chat_id = ? AND message_id IN ?", chatID, messageIDs).Order("message_id").Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	if len(msgs) != len(messageIDs) {
+		return nil, errors.New("some messages do not exist")
+	}
+	withdrawn, err := getWithdrawnSet(db, chatID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.Type == MsgTypeWithdraw || withdrawn[msg.MessageID] {
+			return nil, errors.New("could not forward a withdrawn message")
+		}
+		if msg.BurnAfter > 0 {
+			return nil, errors.New("could not forward a burn-after-reading message")
+		}
+	}
+	return msgs, nil
+}
+
+// forwardOriginOf 获得消息的原始来源，转发的消息再次转发时保留最初的来源
+func forwardOriginOf(msg *Message) *ForwardOrigin {
+	if msg.ForwardChatID != 0 {
+		return &ForwardOrigin{ChatID: msg.ForwardChatID, MessageID: msg.ForwardMessageID, SenderID: msg.ForwardSenderID}
+	}
+	return &ForwardOrigin{ChatID: msg.ChatID, MessageID: msg.MessageID, SenderID: msg.SenderID}
+}
+
+// getMergedForwardItems 获得合并转发消息中的所有聊天记录
+func getMergedForwardItems(db *gorm.DB, chatID int64, messageID int64) ([]MergedForwardItem, error) {
+	ret := make([]MergedForwardItem, 0)
+	return ret, db.Where("chat_id = ? AND message_id = ?", chatID, messageID).Order("seq").Find(&ret).Error
+}
+
+// copyMergedForwardItems 将聊天记录复制到新的合并转发消息中
+func copyMergedForwardItems(db *gorm.DB, items []MergedForwardItem, msg *Message) error {
+	if len(items) == 0 {
+		return nil
+	}
+	copied := make([]MergedForwardItem, 0, len(items))
+	for _, item := range items {
+		item.ID = 0
+		item.ChatID = msg.ChatID
+		item.MessageID = msg.MessageID
+		copied = append(copied, item)
+	}
+	return db.Create(&copied).Error
+}
+
+// ForwardMessages 使用 userID 的身份将聊天 chatID 中的消息逐条转发到 targetChatIDs 中，返回新创建的消息.
+// 合并转发消息被转发时会一并复制其中的聊天记录.
+func ForwardMessages(db *gorm.DB, userID int64, chatID int64, messageIDs []int64, targetChatIDs []int64) ([]*Message, error) {
+	ret := make([]*Message, 0)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !CheckIfUserInChats(tx, userID, uniqueChatIDs(chatID, targetChatIDs)) {
+			return errors.New("user is not in all of the chats")
+		}
+		msgs, err := getForwardableMessages(tx, chatID, messageIDs)
+		if err != nil {
+			return err
+		}
+		for _, targetChatID := range targetChatIDs {
+			for i := range msgs {
+				src := &msgs[i]
+				msg, err := CreateMessageWithOption(tx, targetChatID, userID, src.Type, src.Message, MsgOption{
+					Forward: forwardOriginOf(src),
+				})
+				if err != nil {
+					return err
+				}
+				if src.Type == MsgTypeMergeForward {
+					items, err := getMergedForwardItems(tx, src.ChatID, src.MessageID)
+					if err != nil {
+						return err
+					}
+					if err := copyMergedForwardItems(tx, items, msg); err != nil {
+						return err
+					}
+				}
+				ret = append(ret, msg)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// MergeForwardMessages 使用 userID 的身份将聊天 chatID 中的多条消息合并为一条聊天记录，转发到 targetChatIDs 中
+func MergeForwardMessages(db *gorm.DB, userID int64, chatID int64, messageIDs []int64, targetChatIDs []int64, title string) ([]*Message, error) {
+	ret := make([]*Message, 0)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !CheckIfUserInChats(tx, userID, uniqueChatIDs(chatID, targetChatIDs)) {
+			return errors.New("user is not in all of the chats")
+		}
+		msgs, err := getForwardableMessages(tx, chatID, messageIDs)
+		if err != nil {
+			return err
+		}
+		items := make([]MergedForwardItem, 0, len(msgs))
+		for i, src := range msgs {
+			origin := forwardOriginOf(&src)
+			items = append(items, MergedForwardItem{
+				Seq:             int64(i),
+				OriginChatID:    origin.ChatID,
+				OriginMessageID: origin.MessageID,
+				SenderID:        origin.SenderID,
+				Type:            src.Type,
+				Message:         src.Message,
+				OriginCreatedAt: src.CreatedAt,
+			})
+		}
+		content, err := json.Marshal(&MergedForwardContent{Title: title, Count: len(items)})
+		if err != nil {
+			return err
+		}
+		for _, targetChatID := range targetChatIDs {
+			msg, err := CreateMessage(tx, targetChatID, userID, MsgTypeMergeForward, string(content))
+			if err != nil {
+				return err
+			}
+			if err := copyMergedForwardItems(tx, items, msg); err != nil {
+				return err
+			}
+			ret = append(ret, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetMergedForwardItems 使用 userID 的身份展开一条合并转发消息
+func GetMergedForwardItems(db *gorm.DB, chatID int64, userID int64, messageID int64) ([]MergedForwardItem, error) {
+	msg, err := GetMessage(db, chatID, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MsgTypeMergeForward {
+		return nil, errors.New("the message is not a merged forward message")
+	}
+	if CheckIsWithdrawn(db, chatID, messageID) {
+		return nil, errors.New("the message is already withdrawn")
+	}
+	return getMergedForwardItems(db, chatID, messageID)
+}
@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"github.com/thss-cercis/cercis-server/util/security"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ChatInvite 群聊的邀请链接，通过 Code 加入群聊
+type ChatInvite struct {
+	ID     int64  `gorm:"primaryKey" json:"id"`
+	ChatID int64  `gorm:"index" json:"chat_id"`
+	Code   string `gorm:"type:varChar(31) not null;uniqueIndex" json:"code"`
+	// CreatorID 创建邀请的管理员
+	CreatorID int64 `gorm:"type:bigint not null" json:"creator_id"`
+	// ExpireAt 过期时间，为 null 表示永不过期
+	ExpireAt *time.Time `json:"expire_at"`
+	// MaxUses 最多使用次数，为 0 表示不限制
+	MaxUses int64 `gorm:"type:bigint not null;default:0" json:"max_uses"`
+	Uses    int64 `gorm:"type:bigint not null;default:0" json:"uses"`
+	// RequireApproval 通过此邀请加入时是否需要管理员审核
+	RequireApproval bool `gorm:"not null;default:false" json:"require_approval"`
+	Revoked         bool `gorm:"not null;default:false" json:"revoked"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// InviteOption 创建邀请链接时的可选项
+type InviteOption struct {
+	ExpireAt        *time.Time
+	MaxUses         int64
+	RequireApproval bool
+}
+
+// checkUsable 检查邀请是否仍然可用
+func (invite *ChatInvite) checkUsable(now time.Time) error {
+	if invite.Revoked {
+		return errors.New("the invite is revoked")
+	}
+	if invite.ExpireAt != nil && !invite.ExpireAt.After(now) {
+		return errors.New("the invite is expired")
+	}
+	if invite.MaxUses != 0 && invite.Uses >= invite.MaxUses {
+		return errors.New("the invite has reached its usage limit")
+	}
+	return nil
+}
+
+// CreateChatInvite 创建邀请链接，execID 为执行者，需要为群管理或群主
+func CreateChatInvite(db *gorm.DB, execID int64, chatID int64, opt *InviteOption) (*ChatInvite, error) {
+	if err := CheckGroupPermission(db, chatID, execID, PermAdmin); err != nil {
+		return nil, err
+	}
+	code, err := security.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+	invite := &ChatInvite{
+		ChatID:          chatID,
+		Code:            code,
+		CreatorID:       execID,
+		ExpireAt:        opt.ExpireAt,
+		MaxUses:         opt.MaxUses,
+		RequireApproval: opt.RequireApproval,
+	}
+	return invite, db.Create(invite).Error
+}
+
+// RevokeChatInvite 撤销邀请链接，execID 为执行者，需要为群管理或群主
+func RevokeChatInvite(db *gorm.DB, execID int64, inviteID int64) (*ChatInvite, error) {
+	invite := &ChatInvite{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(invite, inviteID).Error; err != nil {
+			return err
+		}
+		if err := CheckGroupPermission(tx, invite.ChatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		invite.Revoked = true
+		return tx.Save(invite).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// GetChatInvites 获得群聊所有的邀请链接，execID 为执行者，需要为群管理或群主
+func GetChatInvites(db *gorm.DB, execID int64, chatID int64) ([]ChatInvite, error) {
+	if err := CheckGroupPermission(db, chatID, execID, PermAdmin); err != nil {
+		return nil, err
+	}
+	ret := make([]ChatInvite, 0)
+	return ret, db.Where("chat_id = ?", chatID).Order("id DESC").Find(&ret).Error
+}
+
+// GetChatInviteByCode 通过邀请码获得仍然可用的邀请链接
+func GetChatInviteByCode(db *gorm.DB, code string) (*ChatInvite, error) {
+	invite := &ChatInvite{}
+	if err := db.Where("code = ?", code).First(invite).Error; err != nil {
+		return nil, err
+	}
+	if err := invite.checkUsable(time.Now()); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// useChatInvite 锁住邀请链接并检查其仍然可用，之后使用次数加一，在申请人实际加入群聊时调用.
+// 审核期间邀请可能已被撤销、过期或用尽，此时返回错误.
+func useChatInvite(db *gorm.DB, inviteID int64) error {
+	invite := &ChatInvite{}
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).First(invite, inviteID).Error; err != nil {
+		return err
+	}
+	if err := invite.checkUsable(time.Now()); err != nil {
+		return err
+	}
+	return db.Model(invite).Update("uses", gorm.Expr("uses + 1")).Error
+}
+
+// JoinChatByInvite 通过邀请码加入群聊.
+// 邀请不需要审核时直接加入并返回成员表项，需要审核时返回待确定的加群申请.
+func JoinChatByInvite(db *gorm.DB, userID int64, code string, remark string) (*ChatUser, *ChatJoinApply, error) {
+	var chatUser *ChatUser
+	var apply *ChatJoinApply
+	err := db.Transaction(func(tx *gorm.DB) error {
+		invite := &ChatInvite{}
+		// 锁住邀请，避免并发使用超出次数限制
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(invite).Error; err != nil {
+			return err
+		}
+		if err := invite.checkUsable(time.Now()); err != nil {
+			return err
+		}
+		if CheckIfInChat(tx, invite.ChatID, userID) {
+			return errors.New("user is already in the chat")
+		}
+		var err error
+		if invite.RequireApproval {
+			// 申请通过时才计入使用次数
+			apply, err = CreateChatJoinApply(tx, invite.ChatID, userID, 0, invite.ID, remark)
+			return err
+		}
+		if err := useChatInvite(tx, invite.ID); err != nil {
+			return err
+		}
+		chatUser, err = AddChatMember(tx, invite.ChatID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return chatUser, apply, nil
+}
@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// mentionRegexp 文本消息中的提及，<@用户 id> 提及单个成员，<@all> 提及所有成员
+var mentionRegexp = regexp.MustCompile(`<@(\d+|all)>`)
+
+// MessageMention 消息中对某个成员的提及
+type MessageMention struct {
+	ChatID    int64 `gorm:"primaryKey" json:"chat_id"`
+	MessageID int64 `gorm:"primaryKey" json:"message_id"`
+	UserID    int64 `gorm:"primaryKey;index" json:"user_id"`
+	SenderID  int64 `gorm:"type:bigint not null" json:"sender_id"`
+	// All 是否通过 <@all> 提及
+	All bool `gorm:"not null;default:false" json:"all"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MentionIDs 显式提及的用户 id 列表，以 json 存入数据库
+type MentionIDs []int64
+
+// Value 实现 driver.Valuer
+func (ids MentionIDs) Value() (driver.Value, error) {
+	if ids == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(ids)
+	return string(b), err
+}
+
+// Scan 实现 sql.Scanner
+func (ids *MentionIDs) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, ids)
+	case string:
+		return json.Unmarshal([]byte(v), ids)
+	}
+	return errors.Errorf("could not scan %T into mention ids", value)
+}
+
+// ParseMentions 解析文本消息中提及的用户 id（已去重）以及是否提及了所有人
+func ParseMentions(message string) ([]int64, bool) {
+	userIDs := make([]int64, 0)
+	seen := make(map[int64]bool)
+	all := false
+	for _, match := range mentionRegexp.FindAllStringSubmatch(message, -1) {
+		if match[1] == "all" {
+			all = true
+			continue
+		}
+		userID, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, all
+}
+
+// createMentions 保存消息中的提及，包括文本消息中的 <@id> 以及显式给出的 mentionIDs，后者可用于任意类型的消息.
+// 被提及的用户必须在聊天中，<@all> 只有群管理及群主可以使用. 被提及的用户会填入 msg.Mentions，发送者自己不会被提及.
+func createMentions(db *gorm.DB, sender *ChatUser, msg *Message, mentionIDs []int64) error {
+	userIDs, all := make([]int64, 0), false
+	if msg.Type == MsgTypeText {
+		userIDs, all = ParseMentions(msg.Message)
+	}
+	userIDs = append(userIDs, mentionIDs...)
+	if len(userIDs) == 0 && !all {
+		return nil
+	}
+	if all && sender.Permission < PermAdmin {
+		return errors.New("only admins could mention all members")
+	}
+	members, err := GetChatMembers(db, msg.ChatID)
+	if err != nil {
+		return err
+	}
+	memberSet := make(map[int64]bool)
+	for _, member := range members {
+		memberSet[member.UserID] = true
+	}
+	mentioned := make(map[int64]bool)
+	for _, userID := range userIDs {
+		if !memberSet[userID] {
+			return errors.Errorf("mentioned user %v is not in the chat", userID)
+		}
+		mentioned[userID] = true
+	}
+	if all {
+		for userID := range memberSet {
+			mentioned[userID] = true
+		}
+	}
+	delete(mentioned, sender.UserID)
+	if len(mentioned) == 0 {
+		return nil
+	}
+
+	mentions := make([]MessageMention, 0, len(mentioned))
+	for userID := range mentioned {
+		mentions = append(mentions, MessageMention{
+			ChatID:    msg.ChatID,
+			MessageID: msg.MessageID,
+			UserID:    userID,
+			SenderID:  sender.UserID,
+			All:       all,
+		})
+		msg.Mentions = append(msg.Mentions, userID)
+	}
+	return db.Create(&mentions).Error
+}
+
+// GetUnreadMentions 获得 userID 尚未读到的提及，chatID 为 0 时获得所有聊天中的提及，已撤回或删除的消息不计入
+func GetUnreadMentions(db *gorm.DB, userID int64, chatID int64) ([]MessageMention, error) {
+	tx := db.Table("message_mentions AS mm").
+		Select("mm.*").
+		Joins("JOIN chat_users AS cu ON cu.chat_id = mm.chat_id AND cu.user_id = mm.user_id AND cu.deleted_at = 0").
+		Joins("JOIN messages AS m ON m.chat_id = mm.chat_id AND m.message_id = mm.message_id AND m.deleted_at = 0").
+		Where("mm.user_id = ? AND mm.message_id > cu.last_read_message_id", userID).
+		Where("NOT EXISTS (SELECT 1 FROM messages AS w WHERE w.chat_id = mm.chat_id AND w.type = ? "+
+			"AND w.message = mm.message_id::text AND w.deleted_at = 0)", MsgTypeWithdraw)
+	if chatID != 0 {
+		tx = tx.Where("mm.chat_id = ?", chatID)
+	}
+	ret := make([]MessageMention, 0)
+	return ret, tx.Order("mm.chat_id, mm.message_id").Scan(&ret).Error
+}
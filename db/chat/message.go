@@ -2,7 +2,9 @@ package chat
 
 import (
 	"errors"
+	"github.com/thss-cercis/cercis-server/util"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/plugin/soft_delete"
 	"strconv"
 	"time"
@@ -21,6 +23,14 @@ const (
 	MsgTypeVideo = 3
 	// MsgTypeGeo 位置消息
 	MsgTypeGeo = 4
+	// MsgTypeMergeForward 合并转发的聊天记录，内容见 MergedForwardItem
+	MsgTypeMergeForward = 5
+	// MsgTypeFile 文件消息
+	MsgTypeFile = 6
+	// MsgTypeContact 名片消息
+	MsgTypeContact = 7
+	// MsgTypeSticker 表情包消息
+	MsgTypeSticker = 8
 	// MsgTypeWithdraw 撤回消息
 	MsgTypeWithdraw = 100
 )
@@ -37,33 +47,208 @@ type Message struct {
 	// SenderID 消息所属的用户，外键
 	SenderID int64 `gorm:"type:bigint not null" json:"sender_id"`
 
+	// ReplyToID 回复的同一聊天中的消息 id，为 0 表示不是回复
+	ReplyToID int64 `gorm:"type:bigint not null;default:0" json:"reply_to_id"`
+	// ReplyPreview 被回复消息的预览，不存入数据库
+	ReplyPreview *MessagePreview `gorm:"-" json:"reply_preview,omitempty"`
+	// Mentions 创建消息时解析出的被提及的用户，不存入数据库
+	Mentions []int64 `gorm:"-" json:"mentions,omitempty"`
+	// Reactions 表情回应的汇总，不存入数据库
+	Reactions []ReactionCount `gorm:"-" json:"reactions,omitempty"`
+	// EditedAt 最后一次编辑的时间，未编辑过为 null
+	EditedAt *time.Time `json:"edited_at"`
+	// ForwardChatID、ForwardMessageID 与 ForwardSenderID 为转发消息的原始来源，不是转发时均为 0
+	ForwardChatID    int64 `gorm:"type:bigint not null;default:0" json:"forward_chat_id"`
+	ForwardMessageID int64 `gorm:"type:bigint not null;default:0" json:"forward_message_id"`
+	ForwardSenderID  int64 `gorm:"type:bigint not null;default:0" json:"forward_sender_id"`
+	// BurnAfter 阅后即焚，接收者读到后经过多少秒删除，为 0 表示不焚毁
+	BurnAfter int64 `gorm:"type:bigint not null;default:0" json:"burn_after"`
+	// ExpireAt 阅后即焚消息的删除时间，接收者读到后才设置
+	ExpireAt *time.Time `gorm:"index" json:"expire_at"`
+
 	CreatedAt time.Time             `json:"created_at"`
 	UpdatedAt time.Time             `json:"updated_at"`
 	DeletedAt soft_delete.DeletedAt `gorm:"uniqueIndex:idx_chat_message_delete" json:"-"`
 }
 
+// MessageRevision 消息被编辑前的历史版本
+type MessageRevision struct {
+	ID        int64  `gorm:"primaryKey" json:"-"`
+	ChatID    int64  `gorm:"index:idx_chat_message_revision" json:"chat_id"`
+	MessageID int64  `gorm:"index:idx_chat_message_revision" json:"message_id"`
+	Message   string `gorm:"type:text not null" json:"message"`
+	// CreatedAt 此版本成为消息内容的时间，即消息发送或上一次编辑的时间
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessagePreview 被引用消息的简略预览
+type MessagePreview struct {
+	MessageID int64   `json:"message_id"`
+	SenderID  int64   `json:"sender_id"`
+	Type      MsgType `json:"type"`
+	// Sum 消息的前 30 个字，已撤回时为空
+	Sum       string `json:"sum"`
+	Withdrawn bool   `json:"withdrawn"`
+}
+
+// ErrMemberSilenced 发送者被禁言，或群聊开启了全员禁言
+var ErrMemberSilenced = errors.New("member is silenced in the chat")
+
+// MsgOption 创建消息时的可选项
+type MsgOption struct {
+	// ReplyToID 回复的消息 id，只能回复同一聊天中的消息，为 0 表示不是回复
+	ReplyToID int64
+	// BurnAfter 阅后即焚的秒数，只能在私聊中使用，为 0 表示不焚毁
+	BurnAfter int64
+	// Forward 转发消息的原始来源，为 nil 表示不是转发
+	Forward *ForwardOrigin
+	// MentionIDs 显式提及的用户 id，与文本消息中的 <@id> 合并
+	MentionIDs []int64
+}
+
+// ForwardOrigin 转发消息的原始来源
+type ForwardOrigin struct {
+	ChatID    int64
+	MessageID int64
+	SenderID  int64
+}
+
 // CreateMessage 创建一条新的信息，每个 chat 中都有自己独立的一套从 1 开始的 message_id
 func CreateMessage(db *gorm.DB, chatID int64, senderID int64, typ MsgType, message string) (*Message, error) {
+	return CreateMessageWithOption(db, chatID, senderID, typ, message, MsgOption{})
+}
+
+// CreateMessageWithOption 创建一条带有可选项的新信息，会校验被回复的消息
+func CreateMessageWithOption(db *gorm.DB, chatID int64, senderID int64, typ MsgType, message string, opt MsgOption) (*Message, error) {
 	msg := &Message{}
 	return msg, db.Transaction(func(tx *gorm.DB) error {
+		member, err := GetChatMember(tx, chatID, senderID)
+		if err != nil {
+			return errors.New("user is not in the chat")
+		}
+		// 被禁言时仍然可以撤回自己的消息
+		if typ != MsgTypeWithdraw {
+			chat, err := GetChat(tx, chatID)
+			if err != nil {
+				return err
+			}
+			if member.IsSilenced(time.Now()) || (chat.MuteAll && member.Permission < PermAdmin) {
+				return ErrMemberSilenced
+			}
+			if opt.BurnAfter > 0 && chat.Type != ChatTypePrivate {
+				return errors.New("burn after reading is only available in private chat")
+			}
+		}
+		if opt.ReplyToID != 0 {
+			replyTo := &Message{}
+			if err := tx.Where("chat_id = ? AND message_id = ?", chatID, opt.ReplyToID).First(replyTo).Error; err != nil {
+				return errors.New("the replied message does not exist")
+			}
+			if replyTo.Type == MsgTypeWithdraw || CheckIsWithdrawn(tx, chatID, opt.ReplyToID) {
+				return errors.New("could not reply to a withdrawn message")
+			}
+		}
 		var id int64
 		timeNow := time.Now()
-		err := tx.Raw("INSERT INTO messages AS m1 (chat_id, message_id, type, message, sender_id, is_withdrawn, created_at, updated_at, deleted_at) "+
-			"SELECT ?, COALESCE(MAX(m2.message_id),0)+1, ?, ?, ?, ?, ?, ?, ? FROM messages AS m2 WHERE m2.chat_id = ? AND m2.deleted_at = 0"+
+		forward := ForwardOrigin{}
+		if opt.Forward != nil {
+			forward = *opt.Forward
+		}
+		// 已删除的消息也参与计数，避免 message_id 被重复使用
+		err = tx.Raw("INSERT INTO messages AS m1 (chat_id, message_id, type, message, sender_id, reply_to_id, "+
+			"forward_chat_id, forward_message_id, forward_sender_id, burn_after, is_withdrawn, created_at, updated_at, deleted_at) "+
+			"SELECT ?, COALESCE(MAX(m2.message_id),0)+1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM messages AS m2 WHERE m2.chat_id = ? "+
 			"RETURNING m1.id",
-			chatID, typ, message, senderID, false, timeNow, timeNow, 0, chatID).Scan(&id).Error
+			chatID, typ, message, senderID, opt.ReplyToID, forward.ChatID, forward.MessageID, forward.SenderID,
+			opt.BurnAfter, false, timeNow, timeNow, 0, chatID).Scan(&id).Error
 		if err == nil && id != 0 {
 			// 插入成功
 			if err := tx.First(msg, id).Error; err != nil {
 				return err
 			}
-			return nil
+			// 转发的消息不重新解析提及
+			if typ != MsgTypeWithdraw && opt.Forward == nil {
+				if err := createMentions(tx, member, msg, opt.MentionIDs); err != nil {
+					return err
+				}
+			}
+			return FillReplyPreviews(tx, []*Message{msg})
 		} else {
 			return err
 		}
 	})
 }
 
+// FillReplyPreviews 为回复消息填充被回复消息的预览，被回复消息已撤回时预览也显示为已撤回
+func FillReplyPreviews(db *gorm.DB, msgs []*Message) error {
+	// 按聊天收集被回复的消息 id
+	replyIDs := make(map[int64][]int64)
+	for _, msg := range msgs {
+		if msg.ReplyToID != 0 {
+			replyIDs[msg.ChatID] = append(replyIDs[msg.ChatID], msg.ReplyToID)
+		}
+	}
+	previews := make(map[[2]int64]*MessagePreview)
+	for chatID, messageIDs := range replyIDs {
+		replied := make([]Message, 0)
+		if err := db.Where("chat_id = ? AND message_id IN ?", chatID, messageIDs).Find(&replied).Error; err != nil {
+			return err
+		}
+		withdrawn, err := getWithdrawnSet(db, chatID, messageIDs)
+		if err != nil {
+			return err
+		}
+		for _, r := range replied {
+			preview := &MessagePreview{MessageID: r.MessageID, SenderID: r.SenderID, Type: r.Type}
+			if withdrawn[r.MessageID] {
+				preview.Withdrawn = true
+			} else {
+				preview.Sum = util.FirstNCharOfString(r.Message, 30)
+			}
+			previews[[2]int64{chatID, r.MessageID}] = preview
+		}
+	}
+	for _, msg := range msgs {
+		if msg.ReplyToID != 0 {
+			msg.ReplyPreview = previews[[2]int64{msg.ChatID, msg.ReplyToID}]
+		}
+	}
+	return nil
+}
+
+// getWithdrawnSet 获得 messageIDs 中已经被撤回的消息 id 集合
+func getWithdrawnSet(db *gorm.DB, chatID int64, messageIDs []int64) (map[int64]bool, error) {
+	ret := make(map[int64]bool)
+	if len(messageIDs) == 0 {
+		return ret, nil
+	}
+	strIDs := make([]string, 0, len(messageIDs))
+	for _, messageID := range messageIDs {
+		strIDs = append(strIDs, strconv.FormatInt(messageID, 10))
+	}
+	withdraws := make([]string, 0)
+	if err := db.Model(&Message{}).
+		Where("chat_id = ? AND type = ? AND message IN ?", chatID, MsgTypeWithdraw, strIDs).
+		Pluck("message", &withdraws).Error; err != nil {
+		return nil, err
+	}
+	for _, w := range withdraws {
+		if id, err := strconv.ParseInt(w, 10, 64); err == nil {
+			ret[id] = true
+		}
+	}
+	return ret, nil
+}
+
+// toPointers 将消息切片转为指针切片，便于原地填充
+func toPointers(msgs []Message) []*Message {
+	ret := make([]*Message, 0, len(msgs))
+	for i := range msgs {
+		ret = append(ret, &msgs[i])
+	}
+	return ret
+}
+
 // GetMessage 使用 userID 的身份，获取从 chat 中某条消息.
 func GetMessage(db *gorm.DB, chatID int64, userID int64, messageID int64) (*Message, error) {
 	if !CheckIfInChat(db, chatID, userID) {
@@ -73,6 +258,12 @@ func GetMessage(db *gorm.DB, chatID int64, userID int64, messageID int64) (*Mess
 	if err := db.Where("chat_id = ? AND message_id = ?", chatID, messageID).First(msg).Error; err != nil {
 		return nil, err
 	}
+	if err := FillReplyPreviews(db, []*Message{msg}); err != nil {
+		return nil, err
+	}
+	if err := FillReactions(db, userID, []*Message{msg}); err != nil {
+		return nil, err
+	}
 	return msg, nil
 }
 
@@ -99,6 +290,14 @@ func GetMessages(db *gorm.DB, chatID int64, userID int64, fromID int64, toID int
 		tx.Rollback()
 		return nil, err
 	}
+	if err := FillReplyPreviews(tx, toPointers(messages)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := FillReactions(tx, userID, toPointers(messages)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 	return messages, tx.Commit().Error
 }
 
@@ -111,12 +310,15 @@ func GetLatestMessages(db *gorm.DB, userID int64, chatIDs []int64) ([]Message, e
 	if !CheckIfUserInChats(db, userID, chatIDs) {
 		return nil, errors.New("user is not in some of the chats")
 	}
-	// 获取最新信息
-	err := db.Raw("SELECT * FROM messages AS m WHERE (m.chat_id, m.message_id) IN "+
-		"(SELECT chat_id, MAX(message_id) FROM messages WHERE chat_id IN ? GROUP BY chat_id)",
+	// 获取最新信息，原生 sql 不会应用软删除，需要排除已焚毁的消息
+	err := db.Raw("SELECT * FROM messages AS m WHERE m.deleted_at = 0 AND (m.chat_id, m.message_id) IN "+
+		"(SELECT chat_id, MAX(message_id) FROM messages WHERE chat_id IN ? AND deleted_at = 0 GROUP BY chat_id)",
 		chatIDs).
 		Scan(&ret).Error
-	return ret, err
+	if err != nil {
+		return nil, err
+	}
+	return ret, FillReplyPreviews(db, toPointers(ret))
 }
 
 // GetAllChatsLatestMessageID 获得某个用户所有的聊天的最新消息 id
@@ -145,6 +347,64 @@ func GetAllChatsLatestMessageID(db *gorm.DB, userID int64) ([]struct {
 	return ret, err
 }
 
+// ChatUnread 某个用户在某个聊天中的已读位置与未读消息数
+type ChatUnread struct {
+	ChatID            int64 `json:"chat_id"`
+	LastReadMessageID int64 `json:"last_read_message_id"`
+	UnreadCount       int64 `json:"unread_count"`
+}
+
+// GetAllChatsUnread 获得某个用户所有聊天的已读位置与未读消息数，自己发送的消息与撤回消息不计入未读
+func GetAllChatsUnread(db *gorm.DB, userID int64) ([]ChatUnread, error) {
+	ret := make([]ChatUnread, 0)
+	err := db.Raw("SELECT cu.chat_id, cu.last_read_message_id, COUNT(m.id) AS unread_count FROM chat_users AS cu "+
+		"LEFT JOIN messages AS m ON m.chat_id = cu.chat_id AND m.message_id > cu.last_read_message_id "+
+		"AND m.sender_id <> cu.user_id AND m.type <> ? AND m.deleted_at = 0 "+
+		"WHERE cu.user_id = ? AND cu.deleted_at = 0 GROUP BY cu.chat_id, cu.last_read_message_id",
+		MsgTypeWithdraw, userID).
+		Scan(&ret).Error
+	return ret, err
+}
+
+// MarkRead 将 userID 在聊天中的已读位置推进到 messageID，返回推进后的已读位置，advanced 表示已读位置是否前进.
+// 已读位置不会后退，也不会超过聊天中最新的消息.
+func MarkRead(db *gorm.DB, chatID int64, userID int64, messageID int64) (lastRead int64, advanced bool, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		member, err := GetChatMember(tx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		var maxID int64
+		if err := tx.Model(&Message{}).
+			Select("COALESCE(MAX(message_id), 0)").
+			Where("chat_id = ?", chatID).
+			Scan(&maxID).Error; err != nil {
+			return err
+		}
+		if messageID > maxID {
+			messageID = maxID
+		}
+		if messageID <= member.LastReadMessageID {
+			lastRead = member.LastReadMessageID
+			return nil
+		}
+		lastRead = messageID
+		res := tx.Model(&ChatUser{}).
+			Where("id = ? AND last_read_message_id < ?", member.ID, messageID).
+			Update("last_read_message_id", messageID)
+		if res.Error != nil {
+			return res.Error
+		}
+		advanced = res.RowsAffected > 0
+		// 新读到的阅后即焚消息开始倒计时
+		return tx.Model(&Message{}).
+			Where("chat_id = ? AND message_id > ? AND message_id <= ? AND sender_id <> ? AND burn_after > 0 AND expire_at IS NULL",
+				chatID, member.LastReadMessageID, messageID, userID).
+			Update("expire_at", gorm.Expr("? + burn_after * interval '1 second'", time.Now())).Error
+	})
+	return lastRead, advanced, err
+}
+
 // CheckIsWithdrawn 判断消息是否被撤回
 func CheckIsWithdrawn(db *gorm.DB, chatID int64, messageID int64) bool {
 	var count int64
@@ -177,6 +437,99 @@ func WithdrawMessage(db *gorm.DB, chatID int64, userID int64, messageID int64) (
 		if err != nil {
 			return err
 		}
-		return nil
+		// 撤回的消息同时取消置顶
+		return tx.Delete(&PinnedMessage{}, "chat_id = ? AND message_id = ?", chatID, messageID).Error
+	})
+}
+
+// EditMessage 使用 userID 的身份编辑某一条文本消息，旧的内容存入历史版本.
+// 只有发送者可以在发送后的 window 内编辑，window 为 0 表示不限制.
+func EditMessage(db *gorm.DB, chatID int64, userID int64, messageID int64, message string, window time.Duration) (*Message, error) {
+	var msg *Message
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		msg, err = GetMessage(tx, chatID, userID, messageID)
+		if err != nil {
+			return err
+		}
+		if msg.SenderID != userID {
+			return errors.New("could not edit other one's message")
+		}
+		if msg.Type != MsgTypeText {
+			return errors.New("could only edit text message")
+		}
+		if CheckIsWithdrawn(tx, chatID, messageID) {
+			return errors.New("the message is already withdrawn")
+		}
+		if window > 0 && time.Since(msg.CreatedAt) > window {
+			return errors.New("the message could no longer be edited")
+		}
+		// 保存旧版本
+		revisionAt := msg.CreatedAt
+		if msg.EditedAt != nil {
+			revisionAt = *msg.EditedAt
+		}
+		if err := tx.Create(&MessageRevision{
+			ChatID:    chatID,
+			MessageID: messageID,
+			Message:   msg.Message,
+			CreatedAt: revisionAt,
+		}).Error; err != nil {
+			return err
+		}
+		timeNow := time.Now()
+		msg.Message = message
+		msg.EditedAt = &timeNow
+		return tx.Model(msg).Updates(map[string]interface{}{"message": message, "edited_at": timeNow}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetMessageRevisions 使用 userID 的身份，获取某条消息的所有历史版本，按时间升序排列
+func GetMessageRevisions(db *gorm.DB, chatID int64, userID int64, messageID int64) ([]MessageRevision, error) {
+	if !CheckIfInChat(db, chatID, userID) {
+		return nil, errors.New("user is not in the chat")
+	}
+	ret := make([]MessageRevision, 0)
+	return ret, db.Where("chat_id = ? AND message_id = ?", chatID, messageID).Order("id").Find(&ret).Error
+}
+
+// GetReplies 使用 userID 的身份，获取聊天中所有回复了某条消息的消息
+func GetReplies(db *gorm.DB, chatID int64, userID int64, messageID int64) ([]Message, error) {
+	if !CheckIfInChat(db, chatID, userID) {
+		return nil, errors.New("user is not in the chat")
+	}
+	ret := make([]Message, 0)
+	if err := db.Where("chat_id = ? AND reply_to_id = ?", chatID, messageID).Order("message_id").Find(&ret).Error; err != nil {
+		return nil, err
+	}
+	return ret, FillReplyPreviews(db, toPointers(ret))
+}
+
+// DeleteExpiredMessages 软删除至多 limit 条已到期的阅后即焚消息，返回被删除的消息
+func DeleteExpiredMessages(db *gorm.DB, now time.Time, limit int) ([]Message, error) {
+	expired := make([]Message, 0)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("expire_at <= ?", now).
+			Limit(limit).
+			Find(&expired).Error; err != nil {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+		ids := make([]int64, 0, len(expired))
+		for _, msg := range expired {
+			ids = append(ids, msg.ID)
+		}
+		return tx.Delete(&Message{}, ids).Error
 	})
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
 }
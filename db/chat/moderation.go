@@ -0,0 +1,195 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ModerationAction int64
+
+const (
+	// ActionSilence 禁言成员
+	ActionSilence ModerationAction = iota
+	// ActionUnsilence 解除成员禁言
+	ActionUnsilence
+	// ActionBan 移出成员并禁止重新加入
+	ActionBan
+	// ActionUnban 解除禁止加入
+	ActionUnban
+	// ActionKick 移出成员
+	ActionKick
+	// ActionMuteAll 开启全员禁言
+	ActionMuteAll
+	// ActionUnmuteAll 关闭全员禁言
+	ActionUnmuteAll
+)
+
+// banForever 永久禁止加入时使用的截止时间
+var banForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// ModerationLog 群聊管理操作的审计日志
+type ModerationLog struct {
+	ID     int64 `gorm:"primaryKey" json:"id"`
+	ChatID int64 `gorm:"index" json:"chat_id"`
+	// OperatorID 执行操作的管理员
+	OperatorID int64 `gorm:"type:bigint not null" json:"operator_id"`
+	// TargetID 被操作的成员，全员禁言时为 0
+	TargetID int64            `gorm:"type:bigint not null;default:0" json:"target_id"`
+	Action   ModerationAction `gorm:"type:smallint not null" json:"action"`
+	// Until 禁言或禁止加入的截止时间
+	Until *time.Time `json:"until"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// addModerationLog 记录一条管理操作
+func addModerationLog(db *gorm.DB, chatID int64, operatorID int64, targetID int64, action ModerationAction, until *time.Time) error {
+	return db.Create(&ModerationLog{
+		ChatID:     chatID,
+		OperatorID: operatorID,
+		TargetID:   targetID,
+		Action:     action,
+		Until:      until,
+	}).Error
+}
+
+// checkModerate 检查 execID 是否可以管理 userID，需要为群管理或群主且权限高于被管理者
+func checkModerate(db *gorm.DB, execID int64, chatID int64, userID int64) (*ChatUser, error) {
+	if err := CheckGroupPermission(db, chatID, execID, PermAdmin); err != nil {
+		return nil, err
+	}
+	execUser, err := GetChatMember(db, chatID, execID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := GetChatMember(db, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Permission >= execUser.Permission {
+		return nil, errors.New("you have no permission to do this")
+	}
+	return target, nil
+}
+
+// CheckIfBanned 判断用户是否被禁止加入某个群聊
+func CheckIfBanned(db *gorm.DB, chatID int64, userID int64) bool {
+	var count int64
+	if err := db.Unscoped().Model(&ChatUser{}).
+		Where("chat_id = ? AND user_id = ? AND banned_until > ?", chatID, userID, time.Now()).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count >= 1
+}
+
+// getSilencedUntil 获得用户最近一次退出的成员表项上尚未结束的禁言的截止时间，没有时返回 nil.
+// 重新加入时沿用，避免通过退群再加入解除禁言.
+func getSilencedUntil(db *gorm.DB, chatID int64, userID int64) (*time.Time, error) {
+	old := &ChatUser{}
+	err := db.Unscoped().Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Order("deleted_at DESC").First(old).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !old.IsSilenced(time.Now()) {
+		return nil, nil
+	}
+	return old.SilencedUntil, nil
+}
+
+// SilenceMember 禁言成员到 until，until 为零值时解除禁言
+func SilenceMember(db *gorm.DB, execID int64, chatID int64, userID int64, until time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		target, err := checkModerate(tx, execID, chatID, userID)
+		if err != nil {
+			return err
+		}
+		if until.IsZero() {
+			target.SilencedUntil = nil
+			if err := tx.Save(target).Error; err != nil {
+				return err
+			}
+			return addModerationLog(tx, chatID, execID, userID, ActionUnsilence, nil)
+		}
+		target.SilencedUntil = &until
+		if err := tx.Save(target).Error; err != nil {
+			return err
+		}
+		return addModerationLog(tx, chatID, execID, userID, ActionSilence, &until)
+	})
+}
+
+// BanMember 将成员移出群聊并禁止其在 until 前重新加入，until 为 nil 表示永久禁止
+func BanMember(db *gorm.DB, execID int64, chatID int64, userID int64, until *time.Time) error {
+	if until == nil {
+		until = &banForever
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		target, err := checkModerate(tx, execID, chatID, userID)
+		if err != nil {
+			return err
+		}
+		target.BannedUntil = until
+		if err := tx.Save(target).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(target).Error; err != nil {
+			return err
+		}
+		return addModerationLog(tx, chatID, execID, userID, ActionBan, until)
+	})
+}
+
+// UnbanMember 解除对用户的禁止加入
+func UnbanMember(db *gorm.DB, execID int64, chatID int64, userID int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := CheckGroupPermission(tx, chatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		res := tx.Unscoped().Model(&ChatUser{}).
+			Where("chat_id = ? AND user_id = ? AND banned_until > ?", chatID, userID, time.Now()).
+			Update("banned_until", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("user is not banned")
+		}
+		return addModerationLog(tx, chatID, execID, userID, ActionUnban, nil)
+	})
+}
+
+// SetMuteAll 开启或关闭全员禁言，execID 为执行者，需要为群管理或群主
+func SetMuteAll(db *gorm.DB, execID int64, chatID int64, muteAll bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := CheckGroupPermission(tx, chatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		if err := tx.Model(&Chat{}).Where("id = ?", chatID).Update("mute_all", muteAll).Error; err != nil {
+			return err
+		}
+		action := ActionUnmuteAll
+		if muteAll {
+			action = ActionMuteAll
+		}
+		return addModerationLog(tx, chatID, execID, 0, action, nil)
+	})
+}
+
+// GetModerationLogs 获得群聊的管理日志，最新的在前，只有群主可以查询.
+// beforeID 不为 0 时只返回 id 小于它的日志.
+func GetModerationLogs(db *gorm.DB, execID int64, chatID int64, beforeID int64, limit int) ([]ModerationLog, error) {
+	if err := CheckGroupPermission(db, chatID, execID, PermOwner); err != nil {
+		return nil, err
+	}
+	tx := db.Where("chat_id = ?", chatID)
+	if beforeID != 0 {
+		tx = tx.Where("id < ?", beforeID)
+	}
+	ret := make([]ModerationLog, 0)
+	return ret, tx.Order("id DESC").Limit(limit).Find(&ret).Error
+}
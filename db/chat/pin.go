@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// MaxPinnedMessages 单个聊天最多可以置顶的消息数
+const MaxPinnedMessages = 10
+
+// PinnedMessage 群聊中被置顶的消息
+type PinnedMessage struct {
+	ChatID    int64 `gorm:"primaryKey" json:"chat_id"`
+	MessageID int64 `gorm:"primaryKey" json:"message_id"`
+	// PinnedBy 置顶此消息的管理员
+	PinnedBy int64 `gorm:"type:bigint not null" json:"pinned_by"`
+	// Message 被置顶的消息，不存入数据库
+	Message *Message `gorm:"-" json:"message"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PinMessage 置顶消息，execID 为执行者，需要为群管理或群主
+func PinMessage(db *gorm.DB, execID int64, chatID int64, messageID int64) (*PinnedMessage, error) {
+	pin := &PinnedMessage{
+		ChatID:    chatID,
+		MessageID: messageID,
+		PinnedBy:  execID,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := CheckGroupPermission(tx, chatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		// 锁定聊天，保证并发置顶时不超过上限
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Chat{}, chatID).Error; err != nil {
+			return err
+		}
+		msg := &Message{}
+		if err := tx.Where("chat_id = ? AND message_id = ?", chatID, messageID).First(msg).Error; err != nil {
+			return err
+		}
+		if msg.Type == MsgTypeWithdraw || CheckIsWithdrawn(tx, chatID, messageID) {
+			return errors.New("could not pin a withdrawn message")
+		}
+		var pinned int64
+		if err := tx.Model(&PinnedMessage{}).Where("chat_id = ? AND message_id = ?", chatID, messageID).Count(&pinned).Error; err != nil {
+			return err
+		}
+		if pinned != 0 {
+			return errors.New("the message is already pinned")
+		}
+		var count int64
+		if err := tx.Model(&PinnedMessage{}).Where("chat_id = ?", chatID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxPinnedMessages {
+			return errors.Errorf("a chat could pin at most %v messages", MaxPinnedMessages)
+		}
+		return tx.Create(pin).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+// UnpinMessage 取消置顶消息，execID 为执行者，需要为群管理或群主
+func UnpinMessage(db *gorm.DB, execID int64, chatID int64, messageID int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := CheckGroupPermission(tx, chatID, execID, PermAdmin); err != nil {
+			return err
+		}
+		res := tx.Delete(&PinnedMessage{}, "chat_id = ? AND message_id = ?", chatID, messageID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("the message is not pinned")
+		}
+		return nil
+	})
+}
+
+// GetPinnedMessages 获得聊天中所有置顶的消息，最新置顶的在前，不包含已撤回的消息
+func GetPinnedMessages(db *gorm.DB, chatID int64, userID int64) ([]PinnedMessage, error) {
+	if !CheckIfInChat(db, chatID, userID) {
+		return nil, errors.New("user is not in the chat")
+	}
+	pins := make([]PinnedMessage, 0)
+	err := db.Where("chat_id = ?", chatID).
+		Where("NOT EXISTS (SELECT 1 FROM messages AS w WHERE w.chat_id = pinned_messages.chat_id AND w.type = ? "+
+			"AND w.message = pinned_messages.message_id::text AND w.deleted_at = 0)", MsgTypeWithdraw).
+		Order("created_at DESC").Find(&pins).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) == 0 {
+		return pins, nil
+	}
+	messageIDs := make([]int64, 0, len(pins))
+	for _, pin := range pins {
+		messageIDs = append(messageIDs, pin.MessageID)
+	}
+	messages := make([]Message, 0)
+	if err := db.Where("chat_id = ? AND message_id IN ?", chatID, messageIDs).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	msgMap := make(map[int64]*Message)
+	for i := range messages {
+		msgMap[messages[i].MessageID] = &messages[i]
+	}
+	for i := range pins {
+		pins[i].Message = msgMap[pins[i].MessageID]
+	}
+	return pins, nil
+}
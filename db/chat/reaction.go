@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// MessageReaction 成员对消息的表情回应
+type MessageReaction struct {
+	ChatID    int64  `gorm:"primaryKey" json:"chat_id"`
+	MessageID int64  `gorm:"primaryKey" json:"message_id"`
+	UserID    int64  `gorm:"primaryKey" json:"user_id"`
+	Emoji     string `gorm:"primaryKey;type:varChar(31)" json:"emoji"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionCount 消息上某个表情的回应汇总
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+	// Reacted 查询者自己是否使用了此表情回应
+	Reacted bool `json:"reacted"`
+}
+
+// AddReaction 使用 userID 的身份对某条消息添加表情回应，重复添加不报错
+func AddReaction(db *gorm.DB, chatID int64, userID int64, messageID int64, emoji string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if !CheckIfInChat(tx, chatID, userID) {
+			return errors.New("user is not in the chat")
+		}
+		msg := &Message{}
+		if err := tx.Where("chat_id = ? AND message_id = ?", chatID, messageID).First(msg).Error; err != nil {
+			return err
+		}
+		if msg.Type == MsgTypeWithdraw || CheckIsWithdrawn(tx, chatID, messageID) {
+			return errors.New("could not react to a withdrawn message")
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MessageReaction{
+			ChatID:    chatID,
+			MessageID: messageID,
+			UserID:    userID,
+			Emoji:     emoji,
+		}).Error
+	})
+}
+
+// RemoveReaction 使用 userID 的身份取消对某条消息的表情回应
+func RemoveReaction(db *gorm.DB, chatID int64, userID int64, messageID int64, emoji string) error {
+	if !CheckIfInChat(db, chatID, userID) {
+		return errors.New("user is not in the chat")
+	}
+	return db.Delete(&MessageReaction{}, "chat_id = ? AND message_id = ? AND user_id = ? AND emoji = ?",
+		chatID, messageID, userID, emoji).Error
+}
+
+// FillReactions 为消息填充表情回应的汇总，userID 为查询者
+func FillReactions(db *gorm.DB, userID int64, msgs []*Message) error {
+	messageIDs := make(map[int64][]int64)
+	for _, msg := range msgs {
+		messageIDs[msg.ChatID] = append(messageIDs[msg.ChatID], msg.MessageID)
+	}
+	type row struct {
+		ChatID    int64
+		MessageID int64
+		ReactionCount
+	}
+	reactions := make(map[[2]int64][]ReactionCount)
+	for chatID, ids := range messageIDs {
+		rows := make([]row, 0)
+		err := db.Model(&MessageReaction{}).
+			Select("chat_id, message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted", userID).
+			Where("chat_id = ? AND message_id IN ?", chatID, ids).
+			Group("chat_id, message_id, emoji").
+			Order("MIN(created_at)").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			key := [2]int64{r.ChatID, r.MessageID}
+			reactions[key] = append(reactions[key], r.ReactionCount)
+		}
+	}
+	for _, msg := range msgs {
+		msg.Reactions = reactions[[2]int64{msg.ChatID, msg.MessageID}]
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/soft_delete"
+	"time"
+)
+
+type ScheduleState int64
+
+const (
+	// ScheduleStatePending 等待发送
+	ScheduleStatePending ScheduleState = 0
+	// ScheduleStateSent 已经发送
+	ScheduleStateSent ScheduleState = 1
+	// ScheduleStateFailed 到期时发送失败，例如发送者已被禁言或已离开聊天
+	ScheduleStateFailed ScheduleState = 2
+)
+
+// ScheduledMessage 定时发送的消息，到期后由后台任务通过 CreateMessage 发送
+type ScheduledMessage struct {
+	ID       int64   `gorm:"primaryKey" json:"id"`
+	ChatID   int64   `gorm:"type:bigint not null;index" json:"chat_id"`
+	SenderID int64   `gorm:"type:bigint not null;index" json:"sender_id"`
+	Type     MsgType `gorm:"type:smallint not null;check:type >= 0" json:"type"`
+	Message  string  `gorm:"type:text not null" json:"message"`
+	// ReplyToID、BurnAfter 与 MentionIDs 见 MsgOption
+	ReplyToID  int64      `gorm:"type:bigint not null;default:0" json:"reply_to_id"`
+	BurnAfter  int64      `gorm:"type:bigint not null;default:0" json:"burn_after"`
+	MentionIDs MentionIDs `gorm:"type:text not null;default:'[]'" json:"mention_ids"`
+	// SendAt 计划发送的时间
+	SendAt time.Time     `gorm:"not null;index" json:"send_at"`
+	State  ScheduleState `gorm:"type:smallint not null;default:0" json:"state"`
+	// MessageID 发送后的消息 id，未发送时为 0
+	MessageID int64 `gorm:"type:bigint not null;default:0" json:"message_id"`
+	// Error 发送失败的原因
+	Error string `gorm:"type:varChar(255) not null;default:''" json:"error"`
+
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	DeletedAt soft_delete.DeletedAt `gorm:"index" json:"-"`
+}
+
+// CreateScheduledMessage 创建一条定时消息
+func CreateScheduledMessage(db *gorm.DB, chatID int64, senderID int64, typ MsgType, message string, opt MsgOption, sendAt time.Time) (*ScheduledMessage, error) {
+	if !CheckIfInChat(db, chatID, senderID) {
+		return nil, errors.New("user is not in the chat")
+	}
+	if !sendAt.After(time.Now()) {
+		return nil, errors.New("send time should be in the future")
+	}
+	scheduled := &ScheduledMessage{
+		ChatID:     chatID,
+		SenderID:   senderID,
+		Type:       typ,
+		Message:    message,
+		ReplyToID:  opt.ReplyToID,
+		BurnAfter:  opt.BurnAfter,
+		MentionIDs: opt.MentionIDs,
+		SendAt:     sendAt,
+		State:      ScheduleStatePending,
+	}
+	return scheduled, db.Create(scheduled).Error
+}
+
+// CancelScheduledMessage 取消一条尚未发送的定时消息，只有发送者可以取消
+func CancelScheduledMessage(db *gorm.DB, userID int64, scheduledID int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		scheduled := &ScheduledMessage{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(scheduled, scheduledID).Error; err != nil {
+			return err
+		}
+		if scheduled.SenderID != userID {
+			return errors.New("could not cancel other one's scheduled message")
+		}
+		if scheduled.State != ScheduleStatePending {
+			return errors.New("the scheduled message is already processed")
+		}
+		return tx.Delete(scheduled).Error
+	})
+}
+
+// GetScheduledMessages 获得 userID 在聊天中创建的所有定时消息，按计划发送时间排序
+func GetScheduledMessages(db *gorm.DB, chatID int64, userID int64) ([]ScheduledMessage, error) {
+	ret := make([]ScheduledMessage, 0)
+	return ret, db.Where("chat_id = ? AND sender_id = ?", chatID, userID).Order("send_at").Find(&ret).Error
+}
+
+// SendDueScheduledMessages 发送至多 limit 条到期的定时消息，返回发送成功的消息.
+// 使用 SKIP LOCKED，多个实例同时运行时不会重复发送.
+func SendDueScheduledMessages(db *gorm.DB, now time.Time, limit int) ([]*Message, error) {
+	sent := make([]*Message, 0)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		due := make([]ScheduledMessage, 0)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("state = ? AND send_at <= ?", ScheduleStatePending, now).
+			Order("send_at").
+			Limit(limit).
+			Find(&due).Error; err != nil {
+			return err
+		}
+		for i := range due {
+			scheduled := &due[i]
+			msg, err := CreateMessageWithOption(tx, scheduled.ChatID, scheduled.SenderID, scheduled.Type, scheduled.Message, MsgOption{
+				ReplyToID:  scheduled.ReplyToID,
+				BurnAfter:  scheduled.BurnAfter,
+				MentionIDs: scheduled.MentionIDs,
+			})
+			if err != nil {
+				scheduled.State = ScheduleStateFailed
+				scheduled.Error = err.Error()
+			} else {
+				scheduled.State = ScheduleStateSent
+				scheduled.MessageID = msg.MessageID
+				sent = append(sent, msg)
+			}
+			if err := tx.Save(scheduled).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultSearchConfig 未配置时使用的全文检索配置，不会对中文分词，
+// 此时包含中日韩文字的搜索改为使用 pg_trgm 索引的子串匹配
+const defaultSearchConfig = "simple"
+
+// likeSnippetContext 子串匹配时片段中保留的命中位置前后的字符数
+const likeSnippetContext = 20
+
+// snippetStartSel 与 snippetStopSel 为 ts_headline 标记命中关键词时使用的 unicode 私用区字符，
+// 片段整体做 html 转义后再替换为 <em></em>，避免消息原文中的 html 被客户端渲染
+const (
+	snippetStartSel = "\uE000"
+	snippetStopSel  = "\uE001"
+)
+
+var snippetReplacer = strings.NewReplacer(snippetStartSel, "<em>", snippetStopSel, "</em>")
+
+// searchConfigRegexp 全文检索配置名只允许标识符，以便直接拼接进 sql 并命中表达式索引
+var searchConfigRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// SearchOption 搜索消息时的过滤条件
+type SearchOption struct {
+	// ChatID 只搜索某个聊天，为 0 表示用户所在的全部聊天
+	ChatID int64
+	// SenderID 只搜索某个用户发送的消息，为 0 表示不限制
+	SenderID int64
+	// Type 只搜索某种消息，为 nil 表示不限制
+	Type *MsgType
+	// From 与 To 为发送时间的范围，为 nil 表示不限制
+	From *time.Time
+	To   *time.Time
+	// Cursor 只返回内部 id 小于 Cursor 的消息，为 0 表示从最新的开始
+	Cursor int64
+	Limit  int
+}
+
+// SearchResult 消息搜索的单条结果
+type SearchResult struct {
+	Message
+	// Snippet 命中关键词被 <em></em> 包裹的片段，其余内容均已做 html 转义
+	Snippet string `json:"snippet"`
+}
+
+// getSearchConfig 检查并返回全文检索配置名
+func getSearchConfig(searchConfig string) (string, error) {
+	if searchConfig == "" {
+		return defaultSearchConfig, nil
+	}
+	if !searchConfigRegexp.MatchString(searchConfig) {
+		return "", fmt.Errorf("invalid text search config: %v", searchConfig)
+	}
+	return searchConfig, nil
+}
+
+// CreateSearchIndex 为消息内容创建全文检索的 GIN 索引，searchConfig 为 postgres 的全文检索配置名
+func CreateSearchIndex(db *gorm.DB, searchConfig string) error {
+	cfg, err := getSearchConfig(searchConfig)
+	if err != nil {
+		return err
+	}
+	return db.Exec(fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS idx_messages_fts_%v ON messages USING GIN (to_tsvector('%v', message))",
+		cfg, cfg)).Error
+}
+
+// CreateTrigramIndex 使用默认的 simple 配置时，为消息内容创建 pg_trgm 的 GIN 索引，用于加速中日韩文字的子串匹配
+func CreateTrigramIndex(db *gorm.DB, searchConfig string) error {
+	if cfg, err := getSearchConfig(searchConfig); err != nil || cfg != defaultSearchConfig {
+		return err
+	}
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return err
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_trgm ON messages USING GIN (message gin_trgm_ops)").Error
+}
+
+// containsCJK 判断字符串中是否含有中日韩文字
+func containsCJK(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeLike 转义 LIKE 模式中的特殊字符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// buildLikeSnippet 为子串匹配的结果生成片段，截取第一个命中位置附近的内容，命中的关键词被 <em></em> 包裹
+func buildLikeSnippet(message string, terms []string) string {
+	text := []rune(message)
+	lower := []rune(strings.Map(unicode.ToLower, message))
+	hit := make([]bool, len(text))
+	first := -1
+	for _, term := range terms {
+		t := []rune(strings.Map(unicode.ToLower, term))
+		for i := 0; len(t) != 0 && i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != string(t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				hit[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+	if first == -1 {
+		first = 0
+	}
+	from, to := first-likeSnippetContext, first+likeSnippetContext*2
+	if from < 0 {
+		from = 0
+	}
+	if to > len(text) {
+		to = len(text)
+	}
+
+	var b strings.Builder
+	for i := from; i < to; {
+		j := i
+		for j < to && hit[j] == hit[i] {
+			j++
+		}
+		if hit[i] {
+			b.WriteString("<em>" + html.EscapeString(string(text[i:j])) + "</em>")
+		} else {
+			b.WriteString(html.EscapeString(string(text[i:j])))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// SearchMessages 在 userID 所在的聊天中全文搜索消息，不包含已撤回的消息，按时间从新到旧返回.
+// 使用默认的 simple 配置时，包含中日韩文字的搜索改为按空白分隔的关键词做子串匹配.
+func SearchMessages(db *gorm.DB, userID int64, searchConfig string, query string, opt *SearchOption) ([]SearchResult, error) {
+	cfg, err := getSearchConfig(searchConfig)
+	if err != nil {
+		return nil, err
+	}
+	if opt.ChatID != 0 && !CheckIfUserInChats(db, userID, []int64{opt.ChatID}) {
+		return nil, errors.New("user is not in the chat")
+	}
+
+	var terms []string
+	tx := db.Model(&Message{})
+	if cfg == defaultSearchConfig && containsCJK(query) {
+		terms = strings.Fields(query)
+		tx = tx.Select("messages.*")
+		for _, term := range terms {
+			tx = tx.Where(`messages.message ILIKE ? ESCAPE '\'`, "%"+escapeLike(term)+"%")
+		}
+	} else {
+		// 先去掉原文中的标记字符，使片段中的标记只来自 ts_headline
+		tx = tx.Select("messages.*, ts_headline(?::regconfig, translate(messages.message, ?, ''), plainto_tsquery(?::regconfig, ?), ?) AS snippet",
+			cfg, snippetStartSel+snippetStopSel, cfg, query,
+			fmt.Sprintf("StartSel=%v, StopSel=%v, MaxFragments=2, MinWords=5, MaxWords=20", snippetStartSel, snippetStopSel)).
+			Where(fmt.Sprintf("to_tsvector('%v', messages.message) @@ plainto_tsquery('%v', ?)", cfg, cfg), query)
+	}
+	tx = tx.Where("messages.type <> ?", MsgTypeWithdraw).
+		Where("messages.chat_id IN (SELECT chat_id FROM chat_users WHERE user_id = ? AND deleted_at = 0)", userID).
+		Where("NOT EXISTS (SELECT 1 FROM messages AS w WHERE w.chat_id = messages.chat_id AND w.type = ? "+
+			"AND w.message = messages.message_id::text AND w.deleted_at = 0)", MsgTypeWithdraw)
+	if opt.ChatID != 0 {
+		tx = tx.Where("messages.chat_id = ?", opt.ChatID)
+	}
+	if opt.SenderID != 0 {
+		tx = tx.Where("messages.sender_id = ?", opt.SenderID)
+	}
+	if opt.Type != nil {
+		tx = tx.Where("messages.type = ?", *opt.Type)
+	}
+	if opt.From != nil {
+		tx = tx.Where("messages.created_at >= ?", *opt.From)
+	}
+	if opt.To != nil {
+		tx = tx.Where("messages.created_at < ?", *opt.To)
+	}
+	if opt.Cursor != 0 {
+		tx = tx.Where("messages.id < ?", opt.Cursor)
+	}
+
+	results := make([]SearchResult, 0)
+	if err := tx.Order("messages.id DESC").Limit(opt.Limit).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if terms != nil {
+			results[i].Snippet = buildLikeSnippet(results[i].Message.Message, terms)
+		} else {
+			results[i].Snippet = snippetReplacer.Replace(html.EscapeString(results[i].Snippet))
+		}
+	}
+	return results, nil
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"fmt"
+	"github.com/sirupsen/logrus"
 	"github.com/thss-cercis/cercis-server/db/activity"
 	"github.com/thss-cercis/cercis-server/db/chat"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
@@ -11,6 +13,10 @@ import (
 	"github.com/thss-cercis/cercis-server/db/user"
 )
 
+var logFields = logrus.Fields{
+	"module": "db",
+}
+
 var dbNow *gorm.DB = nil
 
 const connectStr = "host=%v user=%v password=%v dbname=%v port=%v sslmode=%v TimeZone=%v"
@@ -36,6 +42,10 @@ func AutoMigrate() {
 	db := GetDB()
 	err := db.Migrator().AutoMigrate(
 		&user.User{}, &user.FriendEntry{}, &user.FriendApply{}, &chat.Chat{}, &chat.ChatUser{}, &chat.Message{},
+		&chat.MessageDelivery{}, &chat.MessageRevision{}, &chat.MessageReaction{},
+		&chat.PinnedMessage{}, &chat.ChatAnnouncement{}, &chat.ChatInvite{}, &chat.ChatJoinApply{},
+		&chat.ModerationLog{}, &chat.ScheduledMessage{}, &chat.MergedForwardItem{},
+		&chat.MessageMention{}, &chat.ExportJob{}, &user.AuditEvent{},
 		&activity.Activity{}, &activity.ActivityMedium{}, &activity.ActivityComment{}, &activity.ActivityThumbUp{},
 	)
 	if err != nil {
@@ -45,6 +55,14 @@ func AutoMigrate() {
 	if cnt, err := user.GetUserCount(db); err == nil && cnt == 0 {
 		db.Exec("alter sequence users_id_seq restart 100001")
 	}
+	// 消息全文检索索引
+	if err := chat.CreateSearchIndex(db, config.GetConfig().Chat.SearchConfig); err != nil {
+		panic(err)
+	}
+	// 未配置中文分词时，中日韩文字的搜索使用子串匹配，索引创建失败时仍可搜索，只是较慢
+	if err := chat.CreateTrigramIndex(db, config.GetConfig().Chat.SearchConfig); err != nil {
+		logger2.GetLogger().WithFields(logFields).Warnf("Create pg_trgm index for message search fail: %v", err)
+	}
 	//创建 join 表
 	err = db.SetupJoinTable(&chat.Chat{}, "Members", &chat.ChatUser{})
 	if err != nil {
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type AuditEventType int64
+
+const (
+	// AuditLoginLocked 连续登录失败，账户被临时锁定
+	AuditLoginLocked AuditEventType = iota
+	// AuditLoginSuspicious 登录成功前，账户或 ip 在窗口内已经失败了多次
+	AuditLoginSuspicious
+	// AuditLoginRateLimited 某个 ip 的登录失败次数过多被限流
+	AuditLoginRateLimited
+)
+
+// AuditEvent 账户安全相关的审计事件
+type AuditEvent struct {
+	ID int64 `gorm:"primaryKey" json:"id"`
+	// UserID 相关的用户，无法确定用户时为 0
+	UserID    int64          `gorm:"type:bigint not null;default:0;index" json:"user_id"`
+	Type      AuditEventType `gorm:"type:smallint not null" json:"type"`
+	IP        string         `gorm:"type:varChar(63) not null" json:"ip"`
+	UserAgent string         `gorm:"type:text not null" json:"user_agent"`
+	// Detail 事件的补充说明
+	Detail string `gorm:"type:text not null" json:"detail"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddAuditEvent 记录一条审计事件
+func AddAuditEvent(db *gorm.DB, event *AuditEvent) error {
+	return db.Create(event).Error
+}
+
+// GetAuditEvents 获得某个用户最近的审计事件，按时间倒序
+func GetAuditEvents(db *gorm.DB, userID int64, limit int) ([]AuditEvent, error) {
+	events := make([]AuditEvent, 0)
+	err := db.Where("user_id = ?", userID).Order("id desc").Limit(limit).Find(&events).Error
+	return events, err
+}
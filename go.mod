@@ -5,14 +5,14 @@ go 1.15
 require (
 	github.com/aliyun/alibaba-cloud-sdk-go v1.61.1051
 	github.com/andybalholm/brotli v1.0.2 // indirect
-	github.com/deckarep/golang-set v1.7.1 // indirect
-	github.com/fasthttp/websocket v1.4.3 // indirect
+	github.com/deckarep/golang-set v1.7.1
+	github.com/fasthttp/websocket v1.4.3
 	github.com/go-playground/universal-translator v0.17.0 // indirect
 	github.com/go-playground/validator/v10 v10.6.0
 	github.com/go-redis/redis/v8 v8.8.2
 	github.com/gofiber/fiber/v2 v2.9.0
 	github.com/gofiber/storage/redis v0.0.0-20201214031209-9829073dd76f
-	github.com/gofiber/websocket/v2 v2.0.3 // indirect
+	github.com/gofiber/websocket/v2 v2.0.3
 	github.com/jackc/pgproto3/v2 v2.0.7 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/json-iterator/go v1.1.11 // indirect
@@ -20,9 +20,9 @@ require (
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	github.com/pkg/errors v0.9.1
-	github.com/qiniu/go-sdk/v7 v7.9.5 // indirect
+	github.com/qiniu/go-sdk/v7 v7.9.5
 	github.com/savsgio/gotils v0.0.0-20210316171653-c54912823645 // indirect
-	github.com/sirupsen/logrus v1.8.1 // indirect
+	github.com/sirupsen/logrus v1.8.1
 	github.com/valyala/fasthttp v1.24.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
 	golang.org/x/crypto v0.0.0-20210506145944-38f3c27a63bf
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/sirupsen/logrus"
+	"github.com/thss-cercis/cercis-server/api"
 	activityApi "github.com/thss-cercis/cercis-server/api/activity"
 	chatApi "github.com/thss-cercis/cercis-server/api/chat"
 	friendApi "github.com/thss-cercis/cercis-server/api/friend"
@@ -14,6 +15,7 @@ import (
 	uploadApi "github.com/thss-cercis/cercis-server/api/upload"
 	logger2 "github.com/thss-cercis/cercis-server/logger"
 	"github.com/thss-cercis/cercis-server/util/sms"
+	"github.com/thss-cercis/cercis-server/ws"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -34,11 +36,15 @@ func main() {
 	// 初始化
 	config.Init(*configPath)
 	cf := config.GetConfig()
-	sms.Init(cf.SMS.Region, cf.SMS.AccessKey, cf.SMS.Secret, cf.SMS.SignName, cf.SMS.TemplateCode)
 	logger2.Init(logrus.Level(cf.Server.Logger.Level))
+	sms.Init(cf.SMS.Provider)
+	ws.Init(cf.Websocket.Backend)
 
 	// 自动迁移数据库
 	db.AutoMigrate()
+	// 定时消息与阅后即焚的后台任务
+	chatApi.StartScheduler()
+	chatApi.StartExportWorker()
 
 	app := fiber.New()
 	// 日志中间件
@@ -50,12 +56,28 @@ func main() {
 
 	// auth
 	v1.Post("/auth/login", auth.Login)
+	v1.Post("/auth/login/sms", auth.LoginBySMS)
 	v1.Post("/auth/logout", middleware.RedisSessionAuthenticate, auth.Logout)
 	v1.Post("/auth/signup", auth.Signup)
+	v1.Post("/auth/token", auth.IssueToken)
+	v1.Post("/auth/token/refresh", auth.RefreshToken)
+	v1.Get("/auth/devices", middleware.RedisSessionAuthenticate, auth.GetDevices)
+	v1.Put("/auth/device/name", middleware.RedisSessionAuthenticate, auth.RenameDevice)
+	v1.Delete("/auth/device", middleware.RedisSessionAuthenticate, auth.RevokeDevice)
+	v1.Delete("/auth/devices/others", middleware.RedisSessionAuthenticate, auth.RevokeOtherDevices)
 	v1.Post("/auth/recover", userApi.RecoverPassword)
 
 	// ! websocket
 	v1.Use("/ws", middleware.WebsocketGetSession, middleware.WebsocketConnect())
+	// websocket 请求帧
+	ws.HandleFunc(api.ReqTypeAddMessage, chatApi.WSAddMessage)
+	ws.HandleFunc(api.ReqTypeWithdrawMessage, chatApi.WSWithdrawMessage)
+	ws.HandleFunc(api.ReqTypeTyping, chatApi.WSTyping)
+	ws.HandleFunc(api.ReqTypeMarkRead, chatApi.WSMarkRead)
+	// websocket 事件送达回调
+	ws.OnDelivered(api.TypeAddNewMessage, chatApi.OnNewMessageDelivered)
+	// websocket 上线与下线回调
+	ws.OnPresenceChange(friendApi.OnPresenceChange)
 
 	// user
 	user := v1.Group("/user", middleware.RedisSessionAuthenticate)
@@ -63,6 +85,7 @@ func main() {
 	user.Put("/modify", userApi.ModifyUser)
 	user.Put("/password", userApi.ModifyPassword)
 	user.Get("/info", userApi.UserInfo)
+	user.Get("/audit-events", userApi.GetAuditEvents)
 
 	// friend
 	friend := v1.Group("/friend", middleware.RedisSessionAuthenticate)
@@ -78,10 +101,12 @@ func main() {
 	// mobile
 	v1.Post("/mobile/signup", mobileApi.SendSMSRegister)
 	v1.Post("/mobile/recover", mobileApi.SendSMSRecover)
+	v1.Post("/mobile/login", mobileApi.SendSMSLogin)
 
 	// search
 	search := v1.Group("/search", middleware.RedisSessionAuthenticate)
 	search.Get("/users", searchApi.SearchUser)
+	search.Get("/messages", searchApi.SearchMessages)
 
 	// chat
 	chat := v1.Group("/chat", middleware.RedisSessionAuthenticate)
@@ -89,6 +114,7 @@ func main() {
 	chat.Post("/private", chatApi.AddPrivateChat)
 	chat.Post("/group", chatApi.AddGroupChat)
 	chat.Get("/all", chatApi.GetAllChats)
+	chat.Put("/settings", chatApi.ModifyChatSettings)
 	chat.Put("/group", chatApi.ModifyGroupChat)
 	chat.Get("/", chatApi.GetAllChatMembers)
 	chat.Delete("/", chatApi.DeleteChat)
@@ -97,6 +123,28 @@ func main() {
 	chat.Put("/group/member/perm", chatApi.ModifyChatMemberPerm)
 	chat.Put("/group/member/owner", chatApi.ChangeGroupOwner)
 	chat.Delete("/group/member", chatApi.DeleteChatMember)
+	chat.Put("/group/member/silence", chatApi.SilenceMember)
+	chat.Post("/group/member/ban", chatApi.BanMember)
+	chat.Delete("/group/member/ban", chatApi.UnbanMember)
+	chat.Put("/group/mute-all", chatApi.SetMuteAll)
+	chat.Get("/group/moderation-logs", chatApi.GetModerationLogs)
+	chat.Post("/group/invite", chatApi.CreateInvite)
+	chat.Delete("/group/invite", chatApi.RevokeInvite)
+	chat.Get("/group/invites", chatApi.GetInvites)
+	chat.Get("/invite", chatApi.GetInviteInfo)
+	chat.Post("/join", chatApi.JoinByInvite)
+	chat.Get("/group/applies", chatApi.GetJoinApplies)
+	chat.Post("/group/apply/accept", chatApi.AcceptJoinApply)
+	chat.Post("/group/apply/reject", chatApi.RejectJoinApply)
+	chat.Get("/applies", chatApi.GetMyJoinApplies)
+	chat.Post("/group/pin", chatApi.PinMessage)
+	chat.Delete("/group/pin", chatApi.UnpinMessage)
+	chat.Get("/group/pins", chatApi.GetPinnedMessages)
+	chat.Put("/group/announcement", chatApi.SetAnnouncement)
+	chat.Get("/group/announcements", chatApi.GetAnnouncementHistory)
+	chat.Post("/export", chatApi.CreateExportJob)
+	chat.Get("/export", chatApi.GetExportJob)
+	chat.Get("/export/download", chatApi.DownloadExport)
 	// chat - message
 	chat.Post("/message", chatApi.AddMessage)
 	chat.Get("/message", chatApi.GetMessage)
@@ -104,6 +152,19 @@ func main() {
 	chat.Post("/messages/latest", chatApi.GetLatestMessages) // Get 方法不好解析数组
 	chat.Get("/messages/all-latest", chatApi.GetAllChatsLatestMessageID)
 	chat.Post("/message/withdraw", chatApi.WithdrawMessage)
+	chat.Post("/message/edit", chatApi.EditMessage)
+	chat.Get("/message/revisions", chatApi.GetMessageRevisions)
+	chat.Get("/message/replies", chatApi.GetReplies)
+	chat.Post("/message/reaction", chatApi.AddReaction)
+	chat.Delete("/message/reaction", chatApi.RemoveReaction)
+	chat.Post("/message/read", chatApi.MarkRead)
+	chat.Get("/mentions", chatApi.GetUnreadMentions)
+	chat.Post("/message/forward", chatApi.ForwardMessages)
+	chat.Get("/message/merged", chatApi.GetMergedForwardItems)
+	chat.Post("/message/schedule", chatApi.AddScheduledMessage)
+	chat.Delete("/message/schedule", chatApi.CancelScheduledMessage)
+	chat.Get("/message/schedules", chatApi.GetScheduledMessages)
+	chat.Post("/typing", chatApi.Typing)
 
 	// activity
 	activity := v1.Group("/activity", middleware.RedisSessionAuthenticate)
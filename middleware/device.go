@@ -0,0 +1,254 @@
+package middleware
+
+// Device 结构说明
+// 每个 session（cookie session 或 token 会话）对应一个登录设备，设备信息存放在 redis 中.
+// 设备 id 为 session id 的哈希，避免在设备列表中暴露 session id 本身.
+
+import (
+	"encoding/json"
+	"errors"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/redis"
+	"github.com/thss-cercis/cercis-server/util/security"
+	"github.com/thss-cercis/cercis-server/ws"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDeviceNotFound 找不到登录设备
+var ErrDeviceNotFound = errors.New("device not found")
+
+// Device 登录设备
+type Device struct {
+	ID string `json:"id"`
+	// Name 用户为设备设置的名称
+	Name string `json:"name"`
+	// Scheme 验证方式，为 AuthSchemeCookie 或 AuthSchemeBearer
+	Scheme     string    `json:"scheme"`
+	Platform   string    `json:"platform"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	// Current 是否为发起请求的设备
+	Current bool `json:"current"`
+}
+
+// deviceRecord 存放在 redis 中的设备信息
+type deviceRecord struct {
+	Device
+	SessionID string `json:"session_id"`
+}
+
+// DeviceID 获得 session 对应的设备 id
+func DeviceID(sessionID string) string {
+	return security.HashToken(sessionID)
+}
+
+// schemeExpiration 获得验证方式对应的 session 有效期
+func schemeExpiration(scheme string) time.Duration {
+	if scheme == AuthSchemeBearer {
+		return redis.ExpAuthRefresh
+	}
+	return sessionExpiration
+}
+
+// detectPlatform 获得客户端平台，优先使用 X-Client-Platform 请求头，否则根据 user agent 推断
+func detectPlatform(c *fiber.Ctx) string {
+	if platform := c.Get("X-Client-Platform"); platform != "" {
+		return platform
+	}
+	ua := c.Get(fiber.HeaderUserAgent)
+	switch {
+	case strings.Contains(ua, "Android"):
+		return "android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iOS"):
+		return "ios"
+	case strings.Contains(ua, "Windows"):
+		return "windows"
+	case strings.Contains(ua, "Mac OS"):
+		return "macos"
+	case strings.Contains(ua, "Linux"):
+		return "linux"
+	}
+	return "unknown"
+}
+
+func getDeviceRecord(deviceID string) (*deviceRecord, error) {
+	raw, err := redis.GetKV(redis.TagAuthDevice, deviceID)
+	if err == goRedis.Nil {
+		return nil, ErrDeviceNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	record := &deviceRecord{}
+	if err := json.Unmarshal([]byte(raw), record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func putDeviceRecord(userID int64, record *deviceRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	exp := schemeExpiration(record.Scheme)
+	if err := redis.PutKV(redis.TagAuthDevice, record.ID, string(data), exp); err != nil {
+		return err
+	}
+	return redis.PutSetMember(redis.TagAuthDevices, strconv.FormatInt(userID, 10), record.ID, exp)
+}
+
+// RegisterDevice 登录后登记当前请求的设备信息
+func RegisterDevice(c *fiber.Ctx, userID int64, sessionID string, scheme string) error {
+	now := time.Now()
+	return putDeviceRecord(userID, &deviceRecord{
+		Device: Device{
+			ID:         DeviceID(sessionID),
+			Scheme:     scheme,
+			Platform:   detectPlatform(c),
+			UserAgent:  c.Get(fiber.HeaderUserAgent),
+			IP:         ClientIP(c),
+			CreatedAt:  now,
+			LastActive: now,
+		},
+		SessionID: sessionID,
+	})
+}
+
+// renewDevice 更新设备的最近活跃时间与请求信息，并续期设备信息，设备信息不存在时重新登记
+func renewDevice(c *fiber.Ctx, userID int64, sessionID string, scheme string) error {
+	record, err := getDeviceRecord(DeviceID(sessionID))
+	if err == ErrDeviceNotFound {
+		// 功能上线前创建的 session
+		return RegisterDevice(c, userID, sessionID, scheme)
+	} else if err != nil {
+		return err
+	}
+	record.Platform = detectPlatform(c)
+	record.UserAgent = c.Get(fiber.HeaderUserAgent)
+	record.IP = ClientIP(c)
+	record.LastActive = time.Now()
+	return putDeviceRecord(userID, record)
+}
+
+// touchDevice 请求通过验证后调用 renewDevice，距离上次更新的间隔过短时不更新
+func touchDevice(c *fiber.Ctx, userID int64, sessionID string, scheme string) {
+	logger := logger2.GetLogger()
+	record, err := getDeviceRecord(DeviceID(sessionID))
+	if err == ErrDeviceNotFound || (err == nil && time.Since(record.LastActive) >= redis.ExpAuthDeviceTouch) {
+		err = renewDevice(c, userID, sessionID, scheme)
+	}
+	if err != nil {
+		logger.WithFields(logFieldsRedis).Errorf("Touch device of session %v fail: %v", sessionID, err)
+	}
+}
+
+// GetDevices 获得用户全部的登录设备，currentSessionID 对应的设备会标记为当前设备
+func GetDevices(userID int64, currentSessionID string) ([]*Device, error) {
+	key := strconv.FormatInt(userID, 10)
+	deviceIDs, err := redis.GetSetMembers(redis.TagAuthDevices, key)
+	if err != nil {
+		return nil, err
+	}
+	currentID := DeviceID(currentSessionID)
+	devices := make([]*Device, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		record, err := getDeviceRecord(deviceID)
+		if err == ErrDeviceNotFound {
+			_ = redis.DelSetMember(redis.TagAuthDevices, key, deviceID)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		record.Current = record.ID == currentID
+		devices = append(devices, &record.Device)
+	}
+	return devices, nil
+}
+
+// getUserDeviceRecord 获得属于某个用户的设备信息
+func getUserDeviceRecord(userID int64, deviceID string) (*deviceRecord, error) {
+	deviceIDs, err := redis.GetSetMembers(redis.TagAuthDevices, strconv.FormatInt(userID, 10))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range deviceIDs {
+		if id == deviceID {
+			return getDeviceRecord(deviceID)
+		}
+	}
+	return nil, ErrDeviceNotFound
+}
+
+// RenameDevice 为设备设置名称
+func RenameDevice(userID int64, deviceID string, name string) error {
+	record, err := getUserDeviceRecord(userID, deviceID)
+	if err != nil {
+		return err
+	}
+	record.Name = name
+	return putDeviceRecord(userID, record)
+}
+
+// RevokeSession 吊销 session，删除设备信息并关闭其 websocket 连接
+func RevokeSession(userID int64, sessionID string) error {
+	logger := logger2.GetLogger()
+	if err := GetStore().Storage.Delete(sessionID); err != nil {
+		return err
+	}
+	if err := RevokeTokenSession(sessionID); err != nil {
+		return err
+	}
+	deviceID := DeviceID(sessionID)
+	if err := redis.DelKV(redis.TagAuthDevice, deviceID); err != nil {
+		return err
+	}
+	if err := redis.DelSetMember(redis.TagAuthDevices, strconv.FormatInt(userID, 10), deviceID); err != nil {
+		return err
+	}
+	if err := ws.CloseSession(sessionID); err != nil {
+		logger.WithFields(logFieldsRedis).Errorf("Close ws conn of session %v fail: %v", sessionID, err)
+	}
+
+	logger.WithFields(logFieldsRedis).Infof("Session of device %v revoked for user_id %v", deviceID, userID)
+	return nil
+}
+
+// RevokeDevice 吊销用户的某个登录设备
+func RevokeDevice(userID int64, deviceID string) error {
+	record, err := getUserDeviceRecord(userID, deviceID)
+	if err != nil {
+		return err
+	}
+	return RevokeSession(userID, record.SessionID)
+}
+
+// RevokeOtherDevices 吊销用户除 keepSessionID 以外的全部登录设备，keepSessionID 为空时全部吊销
+func RevokeOtherDevices(userID int64, keepSessionID string) error {
+	deviceIDs, err := redis.GetSetMembers(redis.TagAuthDevices, strconv.FormatInt(userID, 10))
+	if err != nil {
+		return err
+	}
+	keepID := DeviceID(keepSessionID)
+	for _, deviceID := range deviceIDs {
+		if keepSessionID != "" && deviceID == keepID {
+			continue
+		}
+		record, err := getDeviceRecord(deviceID)
+		if err == ErrDeviceNotFound {
+			_ = redis.DelSetMember(redis.TagAuthDevices, strconv.FormatInt(userID, 10), deviceID)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := RevokeSession(userID, record.SessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
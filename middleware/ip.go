@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/thss-cercis/cercis-server/config"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"net"
+	"strings"
+	"sync"
+)
+
+var logFieldsIP = logrus.Fields{
+	"module":     "ip",
+	"middleware": true,
+}
+
+var trustedProxies []*net.IPNet
+var trustedProxiesOnce sync.Once
+
+// getTrustedProxies 解析配置中的可信代理，支持单个 ip 与 CIDR
+func getTrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		for _, raw := range config.GetConfig().Server.TrustedProxies {
+			if !strings.Contains(raw, "/") {
+				if strings.Contains(raw, ":") {
+					raw += "/128"
+				} else {
+					raw += "/32"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(raw)
+			if err != nil {
+				logger2.GetLogger().WithFields(logFieldsIP).Errorf("Invalid trusted proxy %v: %v", raw, err)
+				continue
+			}
+			trustedProxies = append(trustedProxies, ipNet)
+		}
+	})
+	return trustedProxies
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range getTrustedProxies() {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 获得客户端的 ip. 只有直接连接来自可信代理时才使用 server.proxyheader 指定的请求头，
+// 请求头中有多个 ip 时（如 X-Forwarded-For），从右向左跳过可信代理，取第一个不可信的 ip.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP().String()
+	header := config.GetConfig().Server.ProxyHeader
+	if header == "" || !isTrustedProxy(remote) {
+		return remote
+	}
+	ips := strings.Split(c.Get(header), ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip == "" {
+			continue
+		}
+		if !isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return remote
+}
@@ -1,7 +1,9 @@
 package middleware
 
 // Session 结构说明
-// 目前在 session.Session 中存入一个名为 `user_id` 的键值对
+// 目前在 session.Session 中存入一个名为 `user_id` 的键值对.
+// 通过验证后，无论使用 cookie 中的 session 还是 Bearer token，都会在 ctx 的 locals 中存入
+// `user_id`、`session_id` 与 `auth_scheme`.
 
 import (
 	"github.com/sirupsen/logrus"
@@ -23,6 +25,9 @@ var logFieldsRedis = logrus.Fields{
 
 var store *session.Store
 
+// sessionExpiration cookie session 的有效期
+const sessionExpiration = 24 * time.Hour
+
 // GetStore 获得 redis 数据库连接
 func GetStore() *session.Store {
 	if store == nil {
@@ -36,7 +41,7 @@ func GetStore() *session.Store {
 			Reset:    cr.Reset,
 		})
 		store = session.New(session.Config{
-			Expiration:   24 * time.Hour,
+			Expiration:   sessionExpiration,
 			Storage:      storage,
 			CookieName:   "session_id",
 			KeyGenerator: utils.UUIDv4,
@@ -51,8 +56,17 @@ func GetSession(c *fiber.Ctx) (*session.Session, error) {
 	return sess, err
 }
 
-// GetUserIDFromSession 从 ctx 中的 session 中获取当前 userID
+// AuthSchemeCookie 使用 cookie 中的 session 验证身份
+const AuthSchemeCookie = "cookie"
+
+// AuthSchemeBearer 使用 Bearer access token 验证身份
+const AuthSchemeBearer = "bearer"
+
+// GetUserIDFromSession 获取当前 userID，优先使用验证中间件存入 locals 的值，否则从 ctx 中的 session 中获取
 func GetUserIDFromSession(c *fiber.Ctx) (userID int64, ok bool) {
+	if userID, ok = c.Locals("user_id").(int64); ok {
+		return
+	}
 	sess, err := GetSession(c)
 	if err != nil {
 		return 0, false
@@ -61,7 +75,11 @@ func GetUserIDFromSession(c *fiber.Ctx) (userID int64, ok bool) {
 	return
 }
 
+// GetSessionIDFromSession 获取当前 session id，使用 Bearer token 时为 token 会话 id
 func GetSessionIDFromSession(c *fiber.Ctx) (sessionID string, ok bool) {
+	if sessionID, ok = c.Locals("session_id").(string); ok {
+		return
+	}
 	_, err := GetSession(c)
 	if err != nil {
 		return "", false
@@ -75,9 +93,29 @@ func GetSessionIDFromSession(c *fiber.Ctx) (sessionID string, ok bool) {
 	return
 }
 
-// RedisSessionAuthenticate 使用 redis 的验证用户身份的中间件
+// IsBearerAuth 当前请求是否使用 Bearer token 验证身份
+func IsBearerAuth(c *fiber.Ctx) bool {
+	return c.Locals("auth_scheme") == AuthSchemeBearer
+}
+
+// RedisSessionAuthenticate 使用 redis 的验证用户身份的中间件，
+// 带有 `Authorization: Bearer` 请求头时校验 access token，否则使用 cookie 中的 session
 func RedisSessionAuthenticate(c *fiber.Ctx) error {
 	logger := logger2.GetLogger()
+	if token := getBearerToken(c); token != "" {
+		userID, sessionID, ok := verifyAccessToken(token)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+		}
+		c.Locals("user_id", userID)
+		c.Locals("session_id", sessionID)
+		c.Locals("auth_scheme", AuthSchemeBearer)
+		touchDevice(c, userID, sessionID, AuthSchemeBearer)
+
+		logger.WithFields(logFieldsRedis).Infof("User_id %v with token session %v", userID, sessionID)
+		return c.Next()
+	}
+
 	sess, err := GetSession(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
@@ -92,6 +130,10 @@ func RedisSessionAuthenticate(c *fiber.Ctx) error {
 	if err := sess.Save(); err != nil {
 		panic(err)
 	}
+	c.Locals("user_id", userID)
+	c.Locals("session_id", sess.ID())
+	c.Locals("auth_scheme", AuthSchemeCookie)
+	touchDevice(c, userID, sess.ID(), AuthSchemeCookie)
 
 	logger.WithFields(logFieldsRedis).Infof("User_id %v with session %v", userID, c.Cookies("session_id"))
 	return c.Next()
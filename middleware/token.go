@@ -0,0 +1,179 @@
+package middleware
+
+// Token 结构说明
+// 登录后签发一对 token，二者属于同一个 token 会话：
+//   - access token 为 HS256 签名的 jwt，有效期较短，通过 `Authorization: Bearer <token>` 携带
+//   - refresh token 为随机串，只能使用一次，换取新的 token 对时旧的随即失效
+// token 会话记录在 redis 中，删除即吊销该会话签发的全部 token.
+
+import (
+	"errors"
+	goRedis "github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/thss-cercis/cercis-server/config"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/redis"
+	"github.com/thss-cercis/cercis-server/util/security"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logFieldsToken = logrus.Fields{
+	"module":     "token",
+	"middleware": true,
+}
+
+// ErrRefreshTokenInvalid refresh token 不存在、已过期或已被吊销
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+
+// ErrRefreshTokenReused refresh token 被重复使用，此时整个 token 会话都会被吊销
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// TokenPair 签发给客户端的一对 token
+type TokenPair struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn access token 的有效期，单位为秒
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+var secret []byte
+var secretOnce sync.Once
+
+// getSecret 获得签发 access token 的密钥，未配置时随机生成，此时重启后已签发的 access token 全部失效
+func getSecret() []byte {
+	secretOnce.Do(func() {
+		if s := config.GetConfig().Auth.Secret; s != "" {
+			secret = []byte(s)
+			return
+		}
+		logger2.GetLogger().WithFields(logFieldsToken).Warn("Auth secret is not configured, using a random one")
+		s, err := security.RandomToken(32)
+		if err != nil {
+			panic(err)
+		}
+		secret = []byte(s)
+	})
+	return secret
+}
+
+// IssueTokens 为用户创建新的 token 会话并登记当前设备，签发 token 对
+func IssueTokens(c *fiber.Ctx, userID int64) (*TokenPair, error) {
+	sessionID, err := security.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if err := redis.PutKV(redis.TagAuthTokenSession, sessionID, strconv.FormatInt(userID, 10), redis.ExpAuthRefresh); err != nil {
+		return nil, err
+	}
+	if err := RegisterDevice(c, userID, sessionID, AuthSchemeBearer); err != nil {
+		return nil, err
+	}
+	return signTokens(userID, sessionID)
+}
+
+// RefreshTokens 使用 refresh token 换取新的 token 对，旧的 refresh token 随即失效，同时续期 token 会话与设备信息.
+// 已经轮换掉的 refresh token 再次出现时，说明其可能已经泄露，会吊销整个 token 会话.
+func RefreshTokens(c *fiber.Ctx, refreshToken string) (*TokenPair, error) {
+	hash := security.HashToken(refreshToken)
+	sessionID, err := redis.PopKV(redis.TagAuthRefresh, hash)
+	if err == goRedis.Nil {
+		if sessionID, err := redis.GetKV(redis.TagAuthRefreshUsed, hash); err == nil {
+			logger2.GetLogger().WithFields(logFieldsToken).Warnf("Refresh token of token session %v reused, revoking", sessionID)
+			if userID, err := getTokenSessionUserID(sessionID); err == nil {
+				if err := RevokeSession(userID, sessionID); err != nil {
+					return nil, err
+				}
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if err := redis.PutKV(redis.TagAuthRefreshUsed, hash, sessionID, redis.ExpAuthRefresh); err != nil {
+		return nil, err
+	}
+
+	userID, err := getTokenSessionUserID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	// 续期 token 会话
+	if err := redis.PutKV(redis.TagAuthTokenSession, sessionID, strconv.FormatInt(userID, 10), redis.ExpAuthRefresh); err != nil {
+		return nil, err
+	}
+	if err := renewDevice(c, userID, sessionID, AuthSchemeBearer); err != nil {
+		return nil, err
+	}
+	return signTokens(userID, sessionID)
+}
+
+// RevokeTokenSession 吊销 token 会话，其签发的 access token 与 refresh token 全部失效
+func RevokeTokenSession(sessionID string) error {
+	return redis.DelKV(redis.TagAuthTokenSession, sessionID)
+}
+
+// signTokens 为 token 会话签发 access token 与新的 refresh token
+func signTokens(userID int64, sessionID string) (*TokenPair, error) {
+	now := time.Now()
+	accessToken, err := security.SignJWT(&security.Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(redis.ExpAuthAccess).Unix(),
+	}, getSecret())
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := security.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := redis.PutKV(redis.TagAuthRefresh, security.HashToken(refreshToken), sessionID, redis.ExpAuthRefresh); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(redis.ExpAuthAccess / time.Second),
+	}, nil
+}
+
+// getTokenSessionUserID 获得 token 会话所属的用户，会话已被吊销或过期时返回 ErrRefreshTokenInvalid
+func getTokenSessionUserID(sessionID string) (int64, error) {
+	raw, err := redis.GetKV(redis.TagAuthTokenSession, sessionID)
+	if err == goRedis.Nil {
+		return 0, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(raw, 10, 64)
+}
+
+// getBearerToken 获得请求头中的 Bearer token，没有时返回空串
+func getBearerToken(c *fiber.Ctx) string {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// verifyAccessToken 校验 access token 的签名、有效期以及所属的 token 会话是否已被吊销
+func verifyAccessToken(token string) (userID int64, sessionID string, ok bool) {
+	claims, err := security.ParseJWT(token, getSecret())
+	if err != nil {
+		return 0, "", false
+	}
+	userID, err = getTokenSessionUserID(claims.SessionID)
+	if err != nil || userID != claims.UserID {
+		return 0, "", false
+	}
+	return userID, claims.SessionID, true
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/thss-cercis/cercis-server/api"
 	logger2 "github.com/thss-cercis/cercis-server/logger"
 	"github.com/thss-cercis/cercis-server/ws"
+	"strconv"
 )
 
 var logFieldsWS = logrus.Fields{
@@ -14,15 +15,28 @@ var logFieldsWS = logrus.Fields{
 	"middleware": true,
 }
 
+// WebsocketGetSession 验证 websocket 握手请求的身份，优先使用 `Authorization: Bearer` 请求头，
+// 否则使用 query 中的 session_id
 func WebsocketGetSession(c *fiber.Ctx) error {
-	sessionID := c.Query("session_id")
-	if sessionID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeBadParam, Msg: api.MsgWrongParam})
-	}
-	c.Cookie(&fiber.Cookie{Name: "session_id", Value: sessionID})
-	userID, ok := GetUserIDFromSession(c)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+	var userID int64
+	var sessionID string
+	if token := getBearerToken(c); token != "" {
+		var ok bool
+		userID, sessionID, ok = verifyAccessToken(token)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+		}
+	} else {
+		sessionID = c.Query("session_id")
+		if sessionID == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(api.BaseRes{Code: api.CodeBadParam, Msg: api.MsgWrongParam})
+		}
+		c.Cookie(&fiber.Cookie{Name: "session_id", Value: sessionID})
+		var ok bool
+		userID, ok = GetUserIDFromSession(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(api.BaseRes{Code: api.CodeNotLogin, Msg: api.MsgNotLogin})
+		}
 	}
 	if websocket.IsWebSocketUpgrade(c) {
 		c.Locals("session_id", sessionID)
@@ -40,6 +54,18 @@ func WebsocketConnect() fiber.Handler {
 		logger.WithFields(logFieldsWS).Infof("Create new ws conn of user %v for session %v", userID, sessionID)
 		// 存入当前的 websocket 连接
 		c := ws.PutConn(sessionID, userID, conn.Conn)
+		// 带有 last_seq 时，先补发错过的事件
+		if rawLastSeq := conn.Query("last_seq"); rawLastSeq != "" {
+			lastSeq, err := strconv.ParseInt(rawLastSeq, 10, 64)
+			if err != nil || lastSeq < 0 {
+				lastSeq = 0
+			}
+			if err := c.Replay(lastSeq); err != nil {
+				logger.WithFields(logFieldsWS).Errorf("Replay events for session %v fail: %v", sessionID, err)
+				_ = ws.DelConn(sessionID)
+				return
+			}
+		}
 		c.Start()
 	})
 }
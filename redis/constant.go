@@ -25,3 +25,78 @@ const ExpSMSRecover = 10 * time.Minute
 
 // ExpSMSRecoverRetry sms 密码找回冷却期的键值对有效期
 const ExpSMSRecoverRetry = 58 * time.Second
+
+// TagSMSLogin sms 验证码登录服务的 tag
+const TagSMSLogin = "SMS_Login"
+
+// TagSMSLoginRetry sms 验证码登录冷却期的 tag
+const TagSMSLoginRetry = "SMS_Login_Retry"
+
+// ExpSMSLogin sms 验证码登录服务的键值对有效期
+const ExpSMSLogin = 5 * time.Minute
+
+// ExpSMSLoginRetry sms 验证码登录冷却期的键值对有效期
+const ExpSMSLoginRetry = 58 * time.Second
+
+// TagSMSAttempt sms 验证码错误次数的 tag，键为 "<服务的 tag>_<手机号>"
+const TagSMSAttempt = "SMS_Attempt"
+
+// ChannelWSPush websocket 推送在各个实例之间广播的频道
+const ChannelWSPush = "WS_Push"
+
+// TagWSPresence websocket 在线状态的 tag
+const TagWSPresence = "WS_Presence"
+
+// ExpWSPresence websocket 在线状态的有效期，连接需要在此期间内续期
+const ExpWSPresence = 90 * time.Second
+
+// TagWSInbox websocket 推送收件箱的 tag
+const TagWSInbox = "WS_Inbox"
+
+// ExpWSInbox websocket 推送收件箱的有效期，期间内没有新事件则整体过期
+const ExpWSInbox = 7 * 24 * time.Hour
+
+// TagChatTyping 正在输入事件限流的 tag
+const TagChatTyping = "Chat_Typing"
+
+// ExpChatTyping 同一用户在同一聊天中两次正在输入事件的最小间隔
+const ExpChatTyping = 3 * time.Second
+
+// TagAuthTokenSession token 会话的 tag，值为所属的 user id，删除即吊销该会话签发的全部 token
+const TagAuthTokenSession = "Auth_Token_Session"
+
+// TagAuthRefresh refresh token 的 tag，键为 refresh token 的哈希，值为所属的 token 会话 id
+const TagAuthRefresh = "Auth_Refresh"
+
+// TagAuthRefreshUsed 已经轮换掉的 refresh token 的 tag，用于发现 refresh token 被重复使用
+const TagAuthRefreshUsed = "Auth_Refresh_Used"
+
+// ExpAuthAccess access token 的有效期
+const ExpAuthAccess = 15 * time.Minute
+
+// ExpAuthRefresh refresh token 与 token 会话的有效期，每次轮换时续期
+const ExpAuthRefresh = 30 * 24 * time.Hour
+
+// TagAuthDevice 登录设备信息的 tag，键为设备 id
+const TagAuthDevice = "Auth_Device"
+
+// TagAuthDevices 某个用户全部登录设备的 tag，键为 user id，成员为设备 id
+const TagAuthDevices = "Auth_Devices"
+
+// ExpAuthDeviceTouch 两次更新设备最近活跃时间的最小间隔
+const ExpAuthDeviceTouch = time.Minute
+
+// TagLoginFailAccount 某个账户登录失败记录的 tag，键为 user id
+const TagLoginFailAccount = "Login_Fail_Account"
+
+// TagLoginFailIP 某个 ip 登录失败记录的 tag，键为 ip
+const TagLoginFailIP = "Login_Fail_IP"
+
+// ExpLoginFailWindow 统计登录失败次数的滑动窗口长度
+const ExpLoginFailWindow = 15 * time.Minute
+
+// TagLoginLock 账户被临时锁定的 tag，键为 user id
+const TagLoginLock = "Login_Lock"
+
+// ExpLoginLock 账户被临时锁定的时长
+const ExpLoginLock = 15 * time.Minute
@@ -39,6 +39,17 @@ func PutKV(tag string, key string, value string, exp time.Duration) error {
 	return client.Set(ctx, fmt.Sprintf("%v_%v", tag, key), value, exp).Err()
 }
 
+// PutKVIfAbsent 当键不存在时存放一个键值对，含有有效期. ok 表示是否存放成功.
+func PutKVIfAbsent(tag string, key string, value string, exp time.Duration) (ok bool, err error) {
+	client, err := GetRedis()
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	return client.SetNX(ctx, fmt.Sprintf("%v_%v", tag, key), value, exp).Result()
+}
+
 // GetKV 获得一个键值对中的值.
 //
 // Throws: redis.Nil 表示找不到此 key.
@@ -64,3 +75,56 @@ func GetKVExp(tag string, key string) (time.Duration, error) {
 	ctx := context.Background()
 	return client.TTL(ctx, fmt.Sprintf("%v_%v", tag, key)).Result()
 }
+
+// popKVScript 取值并删除，GETDEL 需要 redis 6.2 以上，因此使用脚本保证原子性
+var popKVScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	redis.call('DEL', KEYS[1])
+end
+return v
+`)
+
+// PopKV 获得并删除一个键值对中的值，取值与删除是原子的.
+//
+// Throws: redis.Nil 表示找不到此 key.
+func PopKV(tag string, key string) (string, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	return popKVScript.Run(ctx, client, []string{fmt.Sprintf("%v_%v", tag, key)}).Text()
+}
+
+// DelKV 删除一个键值对，找不到也返回 nil
+func DelKV(tag string, key string) error {
+	client, err := GetRedis()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return client.Del(ctx, fmt.Sprintf("%v_%v", tag, key)).Err()
+}
+
+// incrKVScript 在同一个脚本中自增并设置有效期，没有有效期的键（PTTL 为 -1）也会补上
+var incrKVScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// IncrKV 将一个键值对的值加一并返回，键不存在时从 0 开始，并设置有效期
+func IncrKV(tag string, key string, exp time.Duration) (int64, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	return incrKVScript.Run(ctx, client, []string{fmt.Sprintf("%v_%v", tag, key)}, exp.Milliseconds()).Int64()
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+)
+
+// Publish 向某个频道发布一条消息
+func Publish(channel string, message interface{}) error {
+	client, err := GetRedis()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe 订阅某个频道，调用者负责关闭返回的 PubSub
+func Subscribe(channel string) (*redis.PubSub, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pubSub := client.Subscribe(ctx, channel)
+	// 等待订阅确认
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return nil, err
+	}
+	return pubSub, nil
+}
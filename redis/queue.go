@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 序列队列：每个元素带有单调递增的序列号，使用 sorted set 实现，score 为序列号，
+// 成员为 "<seq>|<value>"，序列号的计数器单独存放且不过期，保证队列过期后序列号仍然递增.
+
+// SeqQueueItem 序列队列中的元素
+type SeqQueueItem struct {
+	Seq   int64
+	Value string
+}
+
+// pushSeqQueueScript 原子地分配序列号并入队，超出长度的旧元素会被丢弃
+var pushSeqQueueScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[2], seq, seq .. '|' .. ARGV[1])
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[2]) - 1)
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+// PushSeqQueue 向序列队列中追加一个元素，返回分配的序列号.
+// 队列最多保留 maxLen 个元素，超过 exp 没有新元素时整个队列过期.
+func PushSeqQueue(tag string, key string, value string, maxLen int64, exp time.Duration) (int64, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	keys := []string{seqKey(tag, key), fmt.Sprintf("%v_%v", tag, key)}
+	return pushSeqQueueScript.Run(ctx, client, keys, value, maxLen, exp.Milliseconds()).Int64()
+}
+
+// GetSeqQueueAfter 获得序列队列中序列号大于 seq 的所有元素，按序列号升序排列
+func GetSeqQueueAfter(tag string, key string, seq int64) ([]SeqQueueItem, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	members, err := client.ZRangeByScore(ctx, fmt.Sprintf("%v_%v", tag, key), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(seq, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]SeqQueueItem, 0, len(members))
+	for _, member := range members {
+		parts := strings.SplitN(member, "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		s, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, SeqQueueItem{Seq: s, Value: parts[1]})
+	}
+	return ret, nil
+}
+
+// GetSeqQueueSeq 获得序列队列最近分配的序列号，从未入队时为 0
+func GetSeqQueueSeq(tag string, key string) (int64, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	seq, err := client.Get(ctx, seqKey(tag, key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func seqKey(tag string, key string) string {
+	return fmt.Sprintf("%v_Seq_%v", tag, key)
+}
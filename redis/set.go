@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// 带过期时间的集合，使用 sorted set 实现，score 为成员的过期时间戳
+
+// putSetMemberScript 放入成员，集合整体的有效期只会延长，不会因为有效期较短的成员而缩短
+var putSetMemberScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+-- 新建的集合没有有效期，PTTL 为 -1
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 0
+`)
+
+// PutSetMember 向集合中放入一个成员，成员在 exp 后过期，重复放入即为续期
+func PutSetMember(tag string, key string, member string, exp time.Duration) error {
+	client, err := GetRedis()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	k := fmt.Sprintf("%v_%v", tag, key)
+	score := time.Now().Add(exp).Unix()
+	return putSetMemberScript.Run(ctx, client, []string{k}, score, member, exp.Milliseconds()).Err()
+}
+
+// DelSetMember 从集合中删除一个成员，找不到也返回 nil
+func DelSetMember(tag string, key string, member string) error {
+	client, err := GetRedis()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	return client.ZRem(ctx, fmt.Sprintf("%v_%v", tag, key), member).Err()
+}
+
+// GetSetMembers 获得集合中所有未过期的成员
+func GetSetMembers(tag string, key string) ([]string, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	k := fmt.Sprintf("%v_%v", tag, key)
+	// 先清理已经过期的成员
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := client.ZRemRangeByScore(ctx, k, "-inf", "("+now).Err(); err != nil {
+		return nil, err
+	}
+	return client.ZRange(ctx, k, 0, -1).Result()
+}
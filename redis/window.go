@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// 滑动窗口计数：使用 sorted set 实现，score 为每次记录的时间戳（纳秒），只统计窗口内的记录
+
+// PushWindow 在滑动窗口中追加一次记录，返回追加后窗口内的记录数
+func PushWindow(tag string, key string, window time.Duration) (int64, error) {
+	client, err := GetRedis()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	k := fmt.Sprintf("%v_%v", tag, key)
+	now := time.Now().UnixNano()
+	var card *redis.IntCmd
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, k, "-inf", "("+strconv.FormatInt(now-int64(window), 10))
+		pipe.ZAdd(ctx, k, &redis.Z{Score: float64(now), Member: now})
+		card = pipe.ZCard(ctx, k)
+		pipe.PExpire(ctx, k, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return card.Val(), nil
+}
+
+// GetWindow 获得滑动窗口内的记录数，以及最早的记录离开窗口前的剩余时间
+func GetWindow(tag string, key string, window time.Duration) (count int64, retryAfter time.Duration, err error) {
+	client, err := GetRedis()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ctx := context.Background()
+	k := fmt.Sprintf("%v_%v", tag, key)
+	now := time.Now().UnixNano()
+	if err := client.ZRemRangeByScore(ctx, k, "-inf", "("+strconv.FormatInt(now-int64(window), 10)).Err(); err != nil {
+		return 0, 0, err
+	}
+	oldest, err := client.ZRangeWithScores(ctx, k, 0, 0).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(oldest) == 0 {
+		return 0, 0, nil
+	}
+	count, err = client.ZCard(ctx, k).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, time.Duration(int64(oldest[0].Score) + int64(window) - now), nil
+}
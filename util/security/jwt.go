@@ -0,0 +1,75 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrTokenInvalid token 格式或签名错误
+var ErrTokenInvalid = errors.New("token is invalid")
+
+// ErrTokenExpired token 已经过期
+var ErrTokenExpired = errors.New("token is expired")
+
+// jwtHeader HS256 的 jwt 头部，固定不变
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims access token 中携带的信息
+type Claims struct {
+	// UserID 用户 id
+	UserID int64 `json:"uid"`
+	// SessionID token 会话 id，同一次登录签发的 token 共享此 id
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SignJWT 使用 HS256 签发 jwt
+func SignJWT(claims *Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signHS256(unsigned, secret), nil
+}
+
+// ParseJWT 校验 HS256 签名与有效期，并解析出其中的 Claims
+func ParseJWT(token string, secret []byte) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrTokenInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signHS256(parts[0]+"."+parts[1], secret))) {
+		return nil, ErrTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// HashToken 对随机 token 进行 sha256 哈希，用于存储时不保存原文
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func signHS256(unsigned string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
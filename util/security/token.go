@@ -0,0 +1,15 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// RandomToken 生成 n 字节的密码学安全随机数，以 url 安全的 base64 编码返回
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
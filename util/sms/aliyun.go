@@ -0,0 +1,54 @@
+package sms
+
+import (
+	"fmt"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/dysmsapi"
+	"github.com/thss-cercis/cercis-server/config"
+)
+
+// AliyunSender 通过阿里云短信服务发送验证码
+type AliyunSender struct {
+	client   *dysmsapi.Client
+	signName string
+	// templates 各个用途的模板编号
+	templates map[Purpose]string
+}
+
+// NewAliyunSender 根据配置创建 AliyunSender，某个用途未配置模板时使用 templatecode
+func NewAliyunSender() (*AliyunSender, error) {
+	cs := config.GetConfig().SMS
+	client, err := dysmsapi.NewClientWithAccessKey(cs.Region, cs.AccessKey, cs.Secret)
+	if err != nil {
+		return nil, err
+	}
+	templates := map[Purpose]string{
+		PurposeSignUp:  cs.Templates.SignUp,
+		PurposeRecover: cs.Templates.Recover,
+		PurposeLogin:   cs.Templates.Login,
+	}
+	for purpose, template := range templates {
+		if template == "" {
+			templates[purpose] = cs.TemplateCode
+		}
+	}
+	return &AliyunSender{client: client, signName: cs.SignName, templates: templates}, nil
+}
+
+func (s *AliyunSender) SendCode(phone string, purpose Purpose, code string) error {
+	request := dysmsapi.CreateSendSmsRequest()
+	request.Scheme = "https"
+
+	request.PhoneNumbers = phone
+	request.SignName = s.signName
+	request.TemplateCode = s.templates[purpose]
+	request.TemplateParam = fmt.Sprintf("{\"code\":\"%v\"}", code)
+
+	response, err := s.client.SendSms(request)
+	if err != nil {
+		return err
+	}
+	if response.Code != "OK" {
+		return fmt.Errorf("aliyun sms responds %v: %v", response.Code, response.Message)
+	}
+	return nil
+}
@@ -5,3 +5,24 @@ const letterPool = "0123456789"
 
 // letterLen sms code 的长度
 const letterLen = 6
+
+// Purpose 验证码的用途，不同用途可以使用不同的短信模板
+type Purpose string
+
+const (
+	// PurposeSignUp 用户注册
+	PurposeSignUp Purpose = "signup"
+	// PurposeRecover 密码找回
+	PurposeRecover Purpose = "recover"
+	// PurposeLogin 验证码登录
+	PurposeLogin Purpose = "login"
+)
+
+const (
+	// ProviderAliyun 通过阿里云短信服务发送
+	ProviderAliyun = "aliyun"
+	// ProviderLog 不发送短信，只将验证码写入日志，用于本地开发
+	ProviderLog = "log"
+	// ProviderMemory 不发送短信，只将验证码保存在内存中，用于测试
+	ProviderMemory = "memory"
+)
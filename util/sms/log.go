@@ -0,0 +1,14 @@
+package sms
+
+import (
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+)
+
+// LogSender 不发送短信，只将验证码写入日志，用于本地开发
+type LogSender struct{}
+
+func (s *LogSender) SendCode(phone string, purpose Purpose, code string) error {
+	logger := logger2.GetLogger()
+	logger.WithFields(logFields).Warnf("SMS code %v for %v sent to %v", code, purpose, phone)
+	return nil
+}
@@ -0,0 +1,55 @@
+package sms
+
+import "sync"
+
+// SentCode 一条已经发送的验证码
+type SentCode struct {
+	Phone   string
+	Purpose Purpose
+	Code    string
+}
+
+// MemorySender 不发送短信，只将验证码保存在内存中，用于测试
+type MemorySender struct {
+	mutex sync.Mutex
+	sent  []SentCode
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{sent: make([]SentCode, 0)}
+}
+
+func (s *MemorySender) SendCode(phone string, purpose Purpose, code string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sent = append(s.sent, SentCode{Phone: phone, Purpose: purpose, Code: code})
+	return nil
+}
+
+// Sent 获得全部已经发送的验证码
+func (s *MemorySender) Sent() []SentCode {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make([]SentCode, len(s.sent))
+	copy(ret, s.sent)
+	return ret
+}
+
+// Last 获得最近一次发送给某个手机号的某种用途的验证码
+func (s *MemorySender) Last(phone string, purpose Purpose) (code string, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.sent) - 1; i >= 0; i-- {
+		if s.sent[i].Phone == phone && s.sent[i].Purpose == purpose {
+			return s.sent[i].Code, true
+		}
+	}
+	return "", false
+}
+
+// Reset 清空已经发送的验证码
+func (s *MemorySender) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sent = s.sent[:0]
+}
@@ -1,57 +1,77 @@
 package sms
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
-	"github.com/aliyun/alibaba-cloud-sdk-go/services/dysmsapi"
-	"math/rand"
-	"time"
+	"github.com/sirupsen/logrus"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"math/big"
 )
 
-var c *dysmsapi.Client
-var signName string
-var templateCode string
-
-// Init 初始化 sms 服务
-func Init(regionId, accessKeyId, accessKeySecret, _signName, _templateCode string) {
-	signName = _signName
-	templateCode = _templateCode
-	client, err := dysmsapi.NewClientWithAccessKey(regionId, accessKeyId, accessKeySecret)
-	if err == nil {
-		c = client
-	}
+var logFields = logrus.Fields{
+	"module": "sms",
 }
 
-// GetClient 获得 sms 服务的 client
-func GetClient() (client *dysmsapi.Client, ok bool) {
-	if c == nil {
-		return nil, false
-	}
-	return c, true
+// Sender 短信验证码的发送者
+type Sender interface {
+	// SendCode 向手机号发送某种用途的验证码
+	SendCode(phone string, purpose Purpose, code string) error
 }
 
-func SendSMS(client *dysmsapi.Client, phone string, code string) (response *dysmsapi.SendSmsResponse, err error) {
-	if client == nil {
-		return nil, errors.New("nil pointer of sms client")
+var sender Sender
+
+// Init 根据名称选择短信服务提供者，名称为空时使用 ProviderAliyun
+func Init(provider string) {
+	logger := logger2.GetLogger()
+	switch provider {
+	case "", ProviderAliyun:
+		s, err := NewAliyunSender()
+		if err != nil {
+			// 与之前一致，配置有误时不影响启动，发送时返回错误
+			logger.WithFields(logFields).Errorf("Create aliyun sms client fail: %v", err)
+			return
+		}
+		sender = s
+	case ProviderLog:
+		sender = &LogSender{}
+	case ProviderMemory:
+		sender = NewMemorySender()
+	default:
+		panic(fmt.Errorf("unknown sms provider %v", provider))
 	}
-	request := dysmsapi.CreateSendSmsRequest()
-	request.Scheme = "https"
 
-	request.PhoneNumbers = phone
-	request.SignName = signName
-	request.TemplateCode = templateCode
-	request.TemplateParam = fmt.Sprintf("{\"code\":\"%v\"}", code)
+	logger.WithFields(logFields).Infof("SMS provider %v started", provider)
+}
 
-	response, err = client.SendSms(request)
-	return
+// GetSender 获得当前的短信发送者，未初始化时返回 nil
+func GetSender() Sender {
+	return sender
+}
+
+// SetSender 替换当前的短信发送者，用于测试
+func SetSender(s Sender) {
+	sender = s
+}
+
+// SendCode 使用当前的短信发送者发送验证码
+func SendCode(phone string, purpose Purpose, code string) error {
+	if sender == nil {
+		return errors.New("sms sender is not initialized")
+	}
+	return sender.SendCode(phone, purpose, code)
 }
 
-// NewRandomCode 随机生成一个 sms code
-func NewRandomCode() string {
-	rand.Seed(time.Now().Unix())
+// NewRandomCode 使用 crypto/rand 随机生成一个 sms code
+func NewRandomCode() (string, error) {
 	b := make([]byte, letterLen)
+	max := big.NewInt(int64(len(letterPool)))
 	for i := range b {
-		b[i] = letterPool[rand.Intn(len(letterPool))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = letterPool[n.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
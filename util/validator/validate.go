@@ -22,6 +22,9 @@ func GetValidate() *v.Validate {
 		if err := validate.RegisterValidation("password", checkPassword, false); err != nil {
 			panic(err)
 		}
+		if err := validate.RegisterValidation("emoji", checkEmoji, false); err != nil {
+			panic(err)
+		}
 	}
 	return validate
 }
@@ -92,3 +95,80 @@ func checkPhoneNumber(fl v.FieldLevel) bool {
 	}
 	return matched
 }
+
+// emojiRanges 可以作为 emoji 主体的字符范围，参考 unicode 的 Extended_Pictographic 属性
+var emojiRanges = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049}, {0x2122, 0x2122},
+	{0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA}, {0x231A, 0x231B}, {0x2328, 0x2328},
+	{0x23CF, 0x23CF}, {0x23E9, 0x23F3}, {0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB},
+	{0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+	{0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x3030, 0x3030},
+	{0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299}, {0x1F000, 0x1F1E5}, {0x1F200, 0x1FAFF},
+}
+
+const (
+	emojiZWJ           = 0x200D
+	emojiVS16          = 0xFE0F
+	emojiKeycap        = 0x20E3
+	emojiTagStart      = 0xE0020
+	emojiTagEnd        = 0xE007F
+	regionalIndicatorA = 0x1F1E6
+	regionalIndicatorZ = 0x1F1FF
+	skinToneStart      = 0x1F3FB
+	skinToneEnd        = 0x1F3FF
+)
+
+func isEmojiBase(r rune) bool {
+	for _, rg := range emojiRanges {
+		if r >= rg[0] && r <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
+
+// checkEmoji 检查是否为单个 emoji：国旗（两个区域指示符）、键帽（如 1️⃣），
+// 或由 ZWJ 连接的若干 emoji，每个 emoji 后可以跟变体选择符、肤色修饰符以及标签序列（如地区旗帜）.
+func checkEmoji(fl v.FieldLevel) bool {
+	s := []rune(fl.Field().String())
+	if len(s) == 0 {
+		return true
+	}
+	// 国旗
+	if len(s) == 2 && isRegionalIndicator(s[0]) && isRegionalIndicator(s[1]) {
+		return true
+	}
+	// 键帽
+	if (len(s) == 2 || len(s) == 3) && s[len(s)-1] == emojiKeycap &&
+		((s[0] >= '0' && s[0] <= '9') || s[0] == '#' || s[0] == '*') && (len(s) == 2 || s[1] == emojiVS16) {
+		return true
+	}
+
+	i := 0
+	for {
+		if i >= len(s) || !isEmojiBase(s[i]) {
+			return false
+		}
+		i++
+		if i < len(s) && s[i] == emojiVS16 {
+			i++
+		}
+		if i < len(s) && s[i] >= skinToneStart && s[i] <= skinToneEnd {
+			i++
+		}
+		for i < len(s) && s[i] >= emojiTagStart && s[i] <= emojiTagEnd {
+			i++
+		}
+		if i == len(s) {
+			return true
+		}
+		if s[i] != emojiZWJ {
+			return false
+		}
+		i++
+	}
+}
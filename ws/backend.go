@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"fmt"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+)
+
+// Backend websocket 推送的投递后端
+type Backend interface {
+	// Start 启动后端，只在 Init 时调用一次
+	Start() error
+	// Publish 将事件投递给某个 user 的所有连接，无论连接位于哪个实例
+	Publish(userID int64, event *Event) error
+	// SetOnline 登记某个连接为在线状态，需要定期调用以续期
+	SetOnline(userID int64, sessionID string) error
+	// SetOffline 注销某个连接的在线状态
+	SetOffline(userID int64, sessionID string) error
+	// IsOnline 判断某个 user 是否在任意实例上有连接
+	IsOnline(userID int64) (bool, error)
+	// CloseSession 关闭某个 session 的连接，无论连接位于哪个实例
+	CloseSession(sessionID string) error
+}
+
+const (
+	// BackendLocal 仅投递到本实例的连接，适用于单实例部署
+	BackendLocal = "local"
+	// BackendRedis 通过 redis pub/sub 投递到所有实例的连接
+	BackendRedis = "redis"
+)
+
+var backend Backend = &LocalBackend{}
+
+// Init 根据名称选择并启动投递后端，名称为空时使用 BackendLocal
+func Init(name string) {
+	switch name {
+	case "", BackendLocal:
+		backend = &LocalBackend{}
+	case BackendRedis:
+		backend = NewRedisBackend()
+	default:
+		panic(fmt.Errorf("unknown websocket backend %v", name))
+	}
+	if err := backend.Start(); err != nil {
+		panic(err)
+	}
+
+	logger := logger2.GetLogger()
+	logger.WithFields(logFields).Infof("Websocket backend %v started", name)
+}
+
+// GetBackend 获得当前的投递后端
+func GetBackend() Backend {
+	return backend
+}
+
+// IsOnline 判断某个 user 是否在线
+func IsOnline(userID int64) bool {
+	online, err := backend.IsOnline(userID)
+	if err != nil {
+		logger := logger2.GetLogger()
+		logger.WithFields(logFields).Errorf("Get presence of user %v fail: %v", userID, err)
+		return false
+	}
+	return online
+}
+
+// CloseSession 关闭某个 session 的 websocket 连接，用于 session 被吊销时
+func CloseSession(sessionID string) error {
+	return backend.CloseSession(sessionID)
+}
+
+// deliverToLocalUser 将事件写给本实例上某个 user 的所有连接
+func deliverToLocalUser(userID int64, event *Event) error {
+	cons := GetConnByUserID(userID)
+	var errRet error = nil
+	for _, conn := range cons {
+		if conn == nil {
+			continue
+		}
+		if err := conn.Write(event); err != nil {
+			errRet = err
+		}
+	}
+	return errRet
+}
+
+/*******************
+ ** LocalBackend 区域
+ *******************/
+
+// LocalBackend 只在本实例内投递的后端
+type LocalBackend struct{}
+
+func (b *LocalBackend) Start() error {
+	return nil
+}
+
+func (b *LocalBackend) Publish(userID int64, event *Event) error {
+	return deliverToLocalUser(userID, event)
+}
+
+func (b *LocalBackend) SetOnline(int64, string) error {
+	return nil
+}
+
+func (b *LocalBackend) SetOffline(int64, string) error {
+	return nil
+}
+
+func (b *LocalBackend) IsOnline(userID int64) (bool, error) {
+	return len(GetConnByUserID(userID)) > 0, nil
+}
+
+func (b *LocalBackend) CloseSession(sessionID string) error {
+	return DelConn(sessionID)
+}
@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thss-cercis/cercis-server/api"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/util"
+	"github.com/thss-cercis/cercis-server/util/validator"
+	"time"
+)
+
+// Request 客户端通过 websocket 发送的请求帧
+type Request struct {
+	// ID 客户端生成的请求 id，回复帧中原样返回
+	ID      string          `json:"id"`
+	Type    int64           `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Response 对请求帧的回复帧，type 恒为 api.TypeResponse
+type Response struct {
+	Type int64  `json:"type"`
+	ID   string `json:"id"`
+	api.BaseRes
+}
+
+// Handler 处理某一种请求帧，返回值作为回复帧的内容
+type Handler func(conn *ConnWrapper, req *Request) api.BaseRes
+
+var handlers = map[int64]Handler{
+	api.ReqTypePing: handlePing,
+}
+
+// HandleFunc 注册某一种请求帧的处理函数，需要在开始接受连接之前调用
+func HandleFunc(typ int64, handler Handler) {
+	handlers[typ] = handler
+}
+
+// ParsePayload 解析并校验请求帧的 payload，失败时 ok 为 false，res 为应当回复的内容
+func ParsePayload(req *Request, v interface{}) (res api.BaseRes, ok bool) {
+	if err := json.Unmarshal(req.Payload, v); err != nil {
+		return api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, errors.New("反序列化失败"))}, false
+	}
+	if err := validator.Validate(v); err != nil {
+		return api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, err)}, false
+	}
+	return api.BaseRes{}, true
+}
+
+// handle 处理一个请求帧，并将回复帧写入消息队列
+func (wrapper *ConnWrapper) handle(data []byte) {
+	logger := logger2.GetLogger()
+	req := &Request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		_ = wrapper.Write(&Response{
+			Type:    api.TypeResponse,
+			BaseRes: api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, errors.New("反序列化失败"))},
+		})
+		return
+	}
+
+	handler, ok := handlers[req.Type]
+	if !ok {
+		_ = wrapper.Write(&Response{
+			Type:    api.TypeResponse,
+			ID:      req.ID,
+			BaseRes: api.BaseRes{Code: api.CodeBadParam, Msg: util.MsgWithError(api.MsgWrongParam, fmt.Errorf("unknown request type %v", req.Type))},
+		})
+		return
+	}
+
+	res := func() (res api.BaseRes) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.WithFields(logFields).Errorf("Panic when handling request %v of session %v: %v", req.Type, wrapper.SessionID, r)
+				res = api.BaseRes{Code: api.CodeFailure, Msg: api.MsgUnknown}
+			}
+		}()
+		return handler(wrapper, req)
+	}()
+	_ = wrapper.Write(&Response{Type: api.TypeResponse, ID: req.ID, BaseRes: res})
+
+	logger.WithFields(logFields).Tracef("Request %v of type %v handled for session %v", req.ID, req.Type, wrapper.SessionID)
+}
+
+// handlePing 处理客户端心跳
+func handlePing(*ConnWrapper, *Request) api.BaseRes {
+	return api.BaseRes{Code: api.CodeSuccess, Msg: api.MsgSuccess, Payload: struct {
+		Time int64 `json:"time"`
+	}{
+		Time: time.Now().Unix(),
+	}}
+}
@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// DeliveredHook 某种类型的事件成功写入连接后的回调，data 为事件的 json
+type DeliveredHook func(conn *ConnWrapper, data []byte)
+
+var deliveredHooks = make(map[int64][]DeliveredHook)
+var hookMutex = sync.RWMutex{}
+
+// OnDelivered 注册某种类型的事件成功写入连接后的回调，回调在写循环之外的 goroutine 中执行
+func OnDelivered(typ int64, hook DeliveredHook) {
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+	deliveredHooks[typ] = append(deliveredHooks[typ], hook)
+}
+
+// delivered 调用事件对应类型的回调
+func (wrapper *ConnWrapper) delivered(data []byte) {
+	hookMutex.RLock()
+	empty := len(deliveredHooks) == 0
+	hookMutex.RUnlock()
+	if empty {
+		return
+	}
+
+	head := &struct {
+		Type int64 `json:"type"`
+	}{}
+	if err := json.Unmarshal(data, head); err != nil {
+		return
+	}
+	hookMutex.RLock()
+	hooks := deliveredHooks[head.Type]
+	hookMutex.RUnlock()
+	for _, hook := range hooks {
+		hook(wrapper, data)
+	}
+}
+
+// PresenceHook user 上线或下线时的回调，上线指第一个连接建立，下线指最后一个连接断开
+type PresenceHook func(userID int64, online bool)
+
+var presenceHooks = make([]PresenceHook, 0)
+
+// OnPresenceChange 注册 user 上线或下线时的回调，回调在单独的 goroutine 中执行
+func OnPresenceChange(hook PresenceHook) {
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+	presenceHooks = append(presenceHooks, hook)
+}
+
+// firePresence 调用上线或下线的回调
+func firePresence(userID int64, online bool) {
+	hookMutex.RLock()
+	hooks := presenceHooks
+	hookMutex.RUnlock()
+	for _, hook := range hooks {
+		hook(userID, online)
+	}
+}
@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"encoding/json"
+	"github.com/thss-cercis/cercis-server/redis"
+	"strconv"
+)
+
+// inboxMaxLen 每个 user 的收件箱最多保留的事件数
+const inboxMaxLen = 1000
+
+// Event 推送给客户端的事件
+type Event struct {
+	// Seq 事件在 user 收件箱中的序列号，为 0 表示不进入收件箱的事件
+	Seq int64 `json:"seq"`
+	// Data 事件的 json，已经带有 seq 字段
+	Data json.RawMessage `json:"data"`
+}
+
+// pushInbox 将 json 存入 user 的收件箱，返回带有序列号的事件
+func pushInbox(userID int64, data []byte) (*Event, error) {
+	seq, err := redis.PushSeqQueue(redis.TagWSInbox, strconv.FormatInt(userID, 10), string(data), inboxMaxLen, redis.ExpWSInbox)
+	if err != nil {
+		return &Event{Seq: 0, Data: data}, err
+	}
+	event, err := newEvent(seq, data)
+	if err != nil {
+		return &Event{Seq: 0, Data: data}, err
+	}
+	return event, nil
+}
+
+// getInboxAfter 获得 user 收件箱中序列号大于 seq 的事件，missing 表示其中有事件已经过期而无法补发
+func getInboxAfter(userID int64, seq int64) (events []*Event, missing bool, err error) {
+	key := strconv.FormatInt(userID, 10)
+	items, err := redis.GetSeqQueueAfter(redis.TagWSInbox, key, seq)
+	if err != nil {
+		return nil, false, err
+	}
+	events = make([]*Event, 0, len(items))
+	for _, item := range items {
+		event, err := newEvent(item.Seq, []byte(item.Value))
+		if err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(items) > 0 {
+		missing = items[0].Seq > seq+1
+	} else {
+		cur, err := redis.GetSeqQueueSeq(redis.TagWSInbox, key)
+		if err != nil {
+			return nil, false, err
+		}
+		missing = cur > seq
+	}
+	return events, missing, nil
+}
+
+// newEvent 将序列号写入 json object 的 seq 字段
+func newEvent(seq int64, data []byte) (*Event, error) {
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	obj["seq"] = json.RawMessage(strconv.FormatInt(seq, 10))
+	withSeq, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Seq: seq, Data: withSeq}, nil
+}
@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2/utils"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+	"github.com/thss-cercis/cercis-server/redis"
+	"strconv"
+)
+
+// pushEnvelope 在实例之间传递的推送，CloseSession 不为空时表示关闭该 session 的连接
+type pushEnvelope struct {
+	UserID       int64  `json:"user_id"`
+	Event        *Event `json:"event"`
+	CloseSession string `json:"close_session,omitempty"`
+}
+
+// RedisBackend 基于 redis pub/sub 的后端，每个实例订阅同一频道，并投递给自己持有的连接
+type RedisBackend struct {
+	// instanceID 当前实例的标识，用于区分在线状态的来源
+	instanceID string
+}
+
+func NewRedisBackend() *RedisBackend {
+	return &RedisBackend{instanceID: utils.UUIDv4()}
+}
+
+func (b *RedisBackend) Start() error {
+	pubSub, err := redis.Subscribe(redis.ChannelWSPush)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		logger := logger2.GetLogger()
+		for msg := range pubSub.Channel() {
+			envelope := &pushEnvelope{}
+			if err := json.Unmarshal([]byte(msg.Payload), envelope); err != nil {
+				logger.WithFields(logFields).Errorf("Could not decode push envelope: %v", err)
+				continue
+			}
+			if envelope.CloseSession != "" {
+				_ = DelConn(envelope.CloseSession)
+				continue
+			}
+			if envelope.Event == nil {
+				logger.WithFields(logFields).Errorf("Push envelope without event")
+				continue
+			}
+			if err := deliverToLocalUser(envelope.UserID, envelope.Event); err != nil {
+				logger.WithFields(logFields).Debugf("Deliver push to user %v fail: %v", envelope.UserID, err)
+			}
+		}
+		logger.WithFields(logFields).Errorf("Subscription of channel %v closed", redis.ChannelWSPush)
+	}()
+	return nil
+}
+
+func (b *RedisBackend) Publish(userID int64, event *Event) error {
+	envelope, err := json.Marshal(&pushEnvelope{UserID: userID, Event: event})
+	if err != nil {
+		return err
+	}
+	return redis.Publish(redis.ChannelWSPush, envelope)
+}
+
+func (b *RedisBackend) SetOnline(userID int64, sessionID string) error {
+	return redis.PutSetMember(redis.TagWSPresence, strconv.FormatInt(userID, 10), b.member(sessionID), redis.ExpWSPresence)
+}
+
+func (b *RedisBackend) SetOffline(userID int64, sessionID string) error {
+	return redis.DelSetMember(redis.TagWSPresence, strconv.FormatInt(userID, 10), b.member(sessionID))
+}
+
+func (b *RedisBackend) IsOnline(userID int64) (bool, error) {
+	members, err := redis.GetSetMembers(redis.TagWSPresence, strconv.FormatInt(userID, 10))
+	if err != nil {
+		return false, err
+	}
+	return len(members) > 0, nil
+}
+
+func (b *RedisBackend) CloseSession(sessionID string) error {
+	envelope, err := json.Marshal(&pushEnvelope{CloseSession: sessionID})
+	if err != nil {
+		return err
+	}
+	return redis.Publish(redis.ChannelWSPush, envelope)
+}
+
+// member 在线状态集合中的成员名
+func (b *RedisBackend) member(sessionID string) string {
+	return fmt.Sprintf("%v/%v", b.instanceID, sessionID)
+}
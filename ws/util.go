@@ -1,16 +1,31 @@
 package ws
 
-// WriteToUser 将信息写给某个 user 的所有 session
+import (
+	"encoding/json"
+	logger2 "github.com/thss-cercis/cercis-server/logger"
+)
+
+// WriteToUser 将信息写给某个 user 的所有 session，session 可以位于任意实例.
+// 信息会先存入 user 的收件箱，离线的 session 重连时可以通过 last_seq 补发.
 func WriteToUser(userID int64, v interface{}) error {
-	cons := GetConnByUserID(userID)
-	var errRet error = nil
-	for _, conn := range cons {
-		if conn == nil {
-			continue
-		}
-		if err := conn.Write(v); err != nil {
-			errRet = err
-		}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	event, err := pushInbox(userID, data)
+	if err != nil {
+		// 收件箱不可用时仍然尝试直接投递
+		logger := logger2.GetLogger()
+		logger.WithFields(logFields).Errorf("Push event to inbox of user %v fail: %v", userID, err)
+	}
+	return backend.Publish(userID, event)
+}
+
+// WriteToUserEphemeral 将信息写给某个 user 当前在线的所有 session，不存入收件箱，适用于正在输入等临时事件
+func WriteToUserEphemeral(userID int64, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
-	return errRet
+	return backend.Publish(userID, &Event{Seq: 0, Data: data})
 }
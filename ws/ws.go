@@ -5,6 +5,7 @@ import (
 	mapset "github.com/deckarep/golang-set"
 	"github.com/fasthttp/websocket"
 	"github.com/sirupsen/logrus"
+	"github.com/thss-cercis/cercis-server/api"
 	logger2 "github.com/thss-cercis/cercis-server/logger"
 	"sync"
 	"time"
@@ -22,12 +23,16 @@ var logFields = logrus.Fields{
 // PutConn 加入新的 ConnWrapper
 func PutConn(sessionID string, userID int64, conn *websocket.Conn) *ConnWrapper {
 	logger := logger2.GetLogger()
+	// 此前是否在线，用于判断是否为上线
+	wasOnline := IsOnline(userID)
 	// 关闭原来的
 	rwMutex.Lock()
-	defer rwMutex.Unlock()
-	if sessionMapper[sessionID] != nil {
-		if !sessionMapper[sessionID].isClosed {
-			_ = sessionMapper[sessionID].Close()
+	if old := sessionMapper[sessionID]; old != nil {
+		if !old.isClosed {
+			_ = old.Close()
+		}
+		if userMapper[old.UserID] != nil {
+			userMapper[old.UserID].Remove(old)
 		}
 	}
 	newWrapper := New(sessionID, userID, conn)
@@ -40,6 +45,14 @@ func PutConn(sessionID string, userID int64, conn *websocket.Conn) *ConnWrapper
 	} else {
 		userMapper[userID].Add(newWrapper)
 	}
+	rwMutex.Unlock()
+	// 登记在线状态
+	if err := backend.SetOnline(userID, sessionID); err != nil {
+		logger.WithFields(logFields).Errorf("Set presence for session %v fail: %v", sessionID, err)
+	}
+	if !wasOnline {
+		go firePresence(userID, true)
+	}
 
 	logger.WithFields(logFields).Debugf("Add new ws conn for session %v", sessionID)
 	return newWrapper
@@ -49,7 +62,6 @@ func PutConn(sessionID string, userID int64, conn *websocket.Conn) *ConnWrapper
 func DelConn(sessionID string) error {
 	logger := logger2.GetLogger()
 	rwMutex.Lock()
-	defer rwMutex.Unlock()
 	conn := sessionMapper[sessionID]
 	if conn != nil {
 		_ = conn.Close()
@@ -61,11 +73,32 @@ func DelConn(sessionID string) error {
 			delete(userMapper, conn.UserID)
 		}
 	}
+	rwMutex.Unlock()
+	if conn != nil {
+		// 注销在线状态
+		if err := backend.SetOffline(conn.UserID, sessionID); err != nil {
+			logger.WithFields(logFields).Errorf("Unset presence for session %v fail: %v", sessionID, err)
+		}
+		if !IsOnline(conn.UserID) {
+			go firePresence(conn.UserID, false)
+		}
+	}
 
 	logger.WithFields(logFields).Debugf("Remove ws conn for session %v", sessionID)
 	return nil
 }
 
+// delWrapper 关闭并删除某个 ConnWrapper，若同一 session 已经有了新的连接，则不影响新的连接
+func delWrapper(wrapper *ConnWrapper) {
+	_ = wrapper.Close()
+	rwMutex.RLock()
+	current := sessionMapper[wrapper.SessionID]
+	rwMutex.RUnlock()
+	if current == wrapper {
+		_ = DelConn(wrapper.SessionID)
+	}
+}
+
 // GetConn 获得 ConnWrapper，找不到则返回 nil
 func GetConn(sessionID string) *ConnWrapper {
 	logger := logger2.GetLogger()
@@ -105,6 +138,8 @@ type ConnWrapper struct {
 	isClosed   bool
 	closeMutex sync.Mutex
 	ch         chan interface{}
+	// replayedSeq 重连时已经补发的最大序列号，之后收到的序列号不大于它的事件不再重复发送
+	replayedSeq int64
 }
 
 func New(sessionID string, userID int64, conn *websocket.Conn) *ConnWrapper {
@@ -117,6 +152,38 @@ func New(sessionID string, userID int64, conn *websocket.Conn) *ConnWrapper {
 	}
 }
 
+// Replay 补发收件箱中序列号大于 lastSeq 的事件，必须在 Start 之前调用.
+// 补发结束后会发送一个 api.TypeReplayDone 事件，其中 missing 表示有事件已经过期，客户端需要重新拉取数据.
+func (wrapper *ConnWrapper) Replay(lastSeq int64) error {
+	logger := logger2.GetLogger()
+	events, missing, err := getInboxAfter(wrapper.UserID, lastSeq)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := wrapper.conn.WriteJSON(event.Data); err != nil {
+			return err
+		}
+		wrapper.replayedSeq = event.Seq
+		go wrapper.delivered(event.Data)
+	}
+	logger.WithFields(logFields).Debugf("Replay %v events after seq %v to session %v", len(events), lastSeq, wrapper.SessionID)
+
+	latestSeq := lastSeq
+	if wrapper.replayedSeq > latestSeq {
+		latestSeq = wrapper.replayedSeq
+	}
+	return wrapper.conn.WriteJSON(&struct {
+		Type    int64 `json:"type"`
+		LastSeq int64 `json:"last_seq"`
+		Missing bool  `json:"missing"`
+	}{
+		Type:    api.TypeReplayDone,
+		LastSeq: latestSeq,
+		Missing: missing,
+	})
+}
+
 // Start 开始遍历消息队列
 func (wrapper *ConnWrapper) Start() {
 	logger := logger2.GetLogger()
@@ -124,66 +191,96 @@ func (wrapper *ConnWrapper) Start() {
 
 	go func() {
 		t := time.NewTicker(15 * time.Second)
+		defer t.Stop()
 		for range t.C {
-			_ = wrapper.Write(&struct {
+			err := wrapper.Write(&struct {
 				Type int64  `json:"type"`
 				Msg  string `json:"msg"`
 				Time int64  `json:"time"`
 			}{
-				Type: 1,
+				Type: api.TypePing,
 				Msg:  "nmsl",
 				Time: time.Now().Unix(),
 			})
+			if err != nil {
+				break
+			}
 		}
 	}()
 
 	go func() {
 		for {
-			if _, _, err := wrapper.conn.NextReader(); err != nil {
+			_, data, err := wrapper.conn.ReadMessage()
+			if err != nil {
+				delWrapper(wrapper)
 				break
 			}
+			wrapper.handle(data)
 		}
 	}()
 
 	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 LabelFor:
 	for !wrapper.isClosed {
 		select {
 		case <-ticker.C:
 			if err := wrapper.conn.WriteControl(websocket.PingMessage, []byte("heartbeat"), time.Now().Add(5*time.Second)); err != nil {
-				_ = wrapper.Close()
-				_ = DelConn(wrapper.SessionID)
+				delWrapper(wrapper)
 				break LabelFor
 			}
 			logger.WithFields(logFields).Tracef("Heartbeat sent to session %v", wrapper.SessionID)
+			// 续期在线状态
+			if err := backend.SetOnline(wrapper.UserID, wrapper.SessionID); err != nil {
+				logger.WithFields(logFields).Errorf("Refresh presence for session %v fail: %v", wrapper.SessionID, err)
+			}
 			break
 		case jsonObj := <-wrapper.ch:
 			if jsonObj == nil {
 				break LabelFor
 			}
+			event, isEvent := jsonObj.(*Event)
+			if isEvent {
+				// 已经在补发中发送过
+				if event.Seq != 0 && event.Seq <= wrapper.replayedSeq {
+					break
+				}
+				jsonObj = event.Data
+			}
 			if err := wrapper.conn.WriteJSON(jsonObj); err != nil {
-				_ = wrapper.Close()
-				_ = DelConn(wrapper.SessionID)
+				delWrapper(wrapper)
 				break LabelFor
 			}
+			if isEvent {
+				go wrapper.delivered(event.Data)
+			}
 			logger.WithFields(logFields).Tracef("Json obj %v sent to session %v", jsonObj, wrapper.SessionID)
 		}
 	}
 
 }
 
-// Write 向消息队列中写入 json object 的指针
+// Write 向消息队列中写入 json object 的指针或 *Event，不会阻塞.
+// 消息队列已满时说明客户端消费过慢，此时断开连接，由客户端重连后通过 last_seq 补发.
 func (wrapper *ConnWrapper) Write(v interface{}) error {
+	logger := logger2.GetLogger()
 	wrapper.closeMutex.Lock()
-	defer wrapper.closeMutex.Unlock()
 	if wrapper.isClosed {
+		wrapper.closeMutex.Unlock()
 		return errors.New("connection is closed")
 	}
-	wrapper.ch <- v
+	select {
+	case wrapper.ch <- v:
+		wrapper.closeMutex.Unlock()
+		logger.WithFields(logFields).Debugf("Write msg for session %v", wrapper.SessionID)
+		return nil
+	default:
+		wrapper.closeMutex.Unlock()
+	}
 
-	logger := logger2.GetLogger()
-	logger.WithFields(logFields).Debugf("Write msg for session %v", wrapper.SessionID)
-	return nil
+	logger.WithFields(logFields).Warnf("Msg queue of session %v is full, closing", wrapper.SessionID)
+	delWrapper(wrapper)
+	return errors.New("msg queue is full")
 }
 
 // Close 关闭连接，返回 conn.Close 的错误